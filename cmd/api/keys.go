@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fuxi/internal/auth"
+	"fuxi/internal/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleCreateKey 签发API Key，明文只在响应中返回一次
+func handleCreateKey(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name" binding:"required"`
+		Admin      bool   `json:"admin"`
+		DailyQuota int    `json:"daily_quota"` // 0为使用-daily-quota，负数为不限
+		Pool       string `json:"pool"`        // 创建短URL使用的号池，为空时使用默认号池
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "name is required"})
+		return
+	}
+	if req.Pool != "" {
+		if _, ok := pools.Get(req.Pool); !ok {
+			c.JSON(400, gin.H{"error": "unknown pool"})
+			return
+		}
+	}
+
+	key, raw, err := keyStore.CreateAPIKey(req.Name, req.Admin, req.DailyQuota, req.Pool)
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to create API key"})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "API key issued",
+		"key_id", key.ID, "name", key.Name, "admin", key.Admin, "pool", key.Pool, "issued_by", auth.Key(c).Name)
+
+	resp := keyJSON(key)
+	resp["key"] = raw
+	c.JSON(http.StatusCreated, resp)
+}
+
+// handleListKeys 列出所有API Key（不含明文和哈希）
+func handleListKeys(c *gin.Context) {
+	keys, err := keyStore.ListAPIKeys()
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to list API keys"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		items = append(items, keyJSON(&keys[i]))
+	}
+	c.JSON(200, gin.H{"keys": items})
+}
+
+// handleRevokeKey 吊销API Key
+func handleRevokeKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid key id"})
+		return
+	}
+
+	err = keyStore.RevokeAPIKey(uint(id))
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		c.JSON(404, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to revoke API key"})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "API key revoked", "key_id", id, "revoked_by", auth.Key(c).Name)
+
+	c.Status(http.StatusNoContent)
+}
+
+// keyJSON API Key的响应格式
+func keyJSON(key *storage.APIKey) gin.H {
+	resp := gin.H{
+		"id":          key.ID,
+		"name":        key.Name,
+		"prefix":      key.Prefix,
+		"admin":       key.Admin,
+		"daily_quota": key.DailyQuota,
+		"pool":        key.Pool,
+		"created_at":  key.CreatedAt.Format(time.RFC3339),
+		"revoked":     key.Revoked(),
+	}
+	if key.RevokedAt != nil {
+		resp["revoked_at"] = key.RevokedAt.Format(time.RFC3339)
+	}
+	return resp
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fuxi/internal/auth"
+	"fuxi/internal/ratelimit"
+	"fuxi/internal/storage"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaRetention 每日配额记录的保留天数
+const quotaRetention = 7
+
+// quotaSubject 每日配额的计数主体和上限，API Key单独设置的上限优先
+func quotaSubject(defaultLimit int) func(*gin.Context) (string, int) {
+	return func(c *gin.Context) (string, int) {
+		limit := defaultLimit
+		if key := auth.Key(c); key != nil && key.DailyQuota != 0 {
+			limit = key.DailyQuota
+		}
+		return ratelimit.KeyOrIP(c), limit
+	}
+}
+
+// pruneQuotas 每小时删除过期的配额记录，直到ctx取消
+func pruneQuotas(ctx context.Context, s *storage.LayeredStorage) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := s.PruneQuotas(time.Now().AddDate(0, 0, -quotaRetention))
+		if err != nil {
+			slog.Warn("failed to prune quotas", "error", err)
+			continue
+		}
+		if n > 0 {
+			slog.Debug("quotas pruned", "rows", n)
+		}
+	}
+}
@@ -1,20 +1,49 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"fuxi/internal/auth"
+	"fuxi/internal/logging"
+	"fuxi/internal/metrics"
 	"fuxi/internal/preload"
+	"fuxi/internal/ratelimit"
+	"fuxi/internal/redirect"
+	"fuxi/internal/screening"
 	"fuxi/internal/storage"
-	"log"
+	"fuxi/internal/tracing"
+	"fuxi/internal/urlcheck"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// 请求参数的错误码，与urlcheck的错误码一起返回
+const (
+	codeMalformedRequest    = "malformed_request"
+	codeBlocked             = "destination_blocked"
+	codeInvalidRedirectType = "invalid_redirect_type"
+	codeInvalidUTM          = "invalid_utm"
+	codeInvalidRule         = "invalid_rule"
+)
+
 var (
-	linkedURL *preload.LinkedURL
-	store     storage.Storage
+	pools          *preload.Manager
+	store          storage.Storage
+	keyStore       storage.APIKeyStore
+	urls           *urlcheck.Validator
+	screener       *screening.Screener // 未配置拦截名单时为nil
+	acquireTimeout time.Duration
 )
 
 func main() {
@@ -24,45 +53,261 @@ func main() {
 	urlFile := flag.String("urls", "data/shorturls.dat", "短URL文件路径")
 	offsetFile := flag.String("offset", "data/offset.dat", "偏移量文件路径")
 	cacheSize := flag.Int("cache", 100000, "缓存大小")
+	cacheMB := flag.Int64("cache-mb", 0, "缓存内存预算（MB），设置后按字节淘汰并忽略-cache")
+	negativeTTL := flag.Duration("negative-ttl", 30*time.Second, "未找到结果的缓存时长，0为关闭")
+	bloomSize := flag.Int("bloom-size", 0, "已发放短URL布隆过滤器位数（如10000000），0为关闭；多实例共享数据库时必须同时设置-invalidation-file，否则其他实例新建的短URL会返回404")
+	snapshotPath := flag.String("snapshot", "data/hotlinks.json", "热点短URL快照文件，启动时用于预热缓存，为空时关闭")
+	snapshotInterval := flag.Duration("snapshot-interval", time.Minute, "写入热点快照的间隔，0为只在退出时写入")
+	warmupSize := flag.Int("warmup", 10000, "快照记录和启动预热的条目数，无快照时预热访问量最高的短URL，0为关闭")
+	var redisOpts storage.RedisOptions
+	flag.StringVar(&redisOpts.Addr, "redis", "", "Redis二级缓存地址（host:port），为空时不启用")
+	flag.StringVar(&redisOpts.Password, "redis-password", "", "Redis密码")
+	flag.IntVar(&redisOpts.DB, "redis-db", 0, "Redis数据库编号")
+	flag.StringVar(&redisOpts.KeyPrefix, "redis-prefix", "fuxi:", "Redis key前缀")
+	flag.DurationVar(&redisOpts.Timeout, "redis-timeout", 200*time.Millisecond, "Redis连接和命令超时，超时后回退到数据库")
+	l2MaxTTL := flag.Duration("redis-max-ttl", 10*time.Minute, "二级缓存条目最长有效期，限制其他途径修改数据库后旧值的存留时间，0为与短URL过期时间一致")
+	invalidationFile := flag.String("invalidation-file", "", "多实例缓存失效广播文件（各实例共享同一路径），为空时不启用")
+	invalidationInterval := flag.Duration("invalidation-interval", 100*time.Millisecond, "读取失效广播文件的间隔")
+	invalidationMaxMB := flag.Int("invalidation-max-mb", 16, "失效广播文件超过该大小（MB）时轮转，0为不轮转")
+	cachePolicy := flag.String("cache-policy", storage.PolicyLRU, "缓存淘汰策略: lru, tinylfu, arc")
+	useMmap := flag.Bool("mmap", false, "使用内存映射读取短URL文件（适合大号池）")
+	poolConfig := flag.String("pools", "", "多号池配置文件（JSON），设置后忽略-urls/-offset/-mmap")
+	threshold := flag.Int("preload-threshold", 2000, "预加载阈值（自适应模式下为初始值）")
+	batchSize := flag.Int("preload-batch", 10000, "预加载批量（自适应模式下为初始值）")
+	adaptive := flag.Bool("preload-adaptive", true, "根据获取速率自动调整阈值和批量")
+	adaptiveCfg := preload.DefaultAdaptiveConfig()
+	flag.IntVar(&adaptiveCfg.MinThreshold, "preload-min-threshold", adaptiveCfg.MinThreshold, "自适应阈值下限")
+	flag.IntVar(&adaptiveCfg.MaxThreshold, "preload-max-threshold", adaptiveCfg.MaxThreshold, "自适应阈值上限")
+	flag.IntVar(&adaptiveCfg.MinBatch, "preload-min-batch", adaptiveCfg.MinBatch, "自适应批量下限")
+	flag.IntVar(&adaptiveCfg.MaxBatch, "preload-max-batch", adaptiveCfg.MaxBatch, "自适应批量上限")
+	flag.DurationVar(&adaptiveCfg.Horizon, "preload-horizon", adaptiveCfg.Horizon, "每批短URL应覆盖的时长")
+	flag.DurationVar(&acquireTimeout, "acquire-timeout", 2*time.Second, "预加载链表为空时等待补充的最长时间")
+	permanentMaxAge := flag.Duration("permanent-max-age", 24*time.Hour, "301/308重定向允许客户端和代理缓存的时长，修改或停用永久重定向的短URL后最长要等这么久才生效")
+	traceCfg := tracing.Config{ServiceName: "fuxi"}
+	flag.StringVar(&traceCfg.Exporter, "trace-exporter", tracing.ExporterNone, "链路追踪导出方式: none, stdout, otlp")
+	flag.StringVar(&traceCfg.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP Collector地址（host:port），为空时使用OTEL_EXPORTER_OTLP_ENDPOINT或localhost:4318")
+	flag.BoolVar(&traceCfg.OTLPInsecure, "otlp-insecure", false, "使用HTTP而不是HTTPS连接Collector")
+	flag.Float64Var(&traceCfg.SampleRatio, "trace-sample", 1.0, "根span采样比例（0到1），带traceparent的请求沿用上游决定")
+	authEnabled := flag.Bool("auth", true, "要求API Key（Authorization: Bearer <key>），关闭后所有接口公开，仅用于本地开发")
+	adminKey := flag.String("admin-key", os.Getenv("FUXI_ADMIN_KEY"), "引导管理员Key，用于签发第一批API Key（默认读取FUXI_ADMIN_KEY）")
+	createRate := flag.Float64("create-rate", 10, "每个API Key（未认证时每个IP）每秒可创建的短URL数，0为不限")
+	createBurst := flag.Int("create-burst", 20, "创建短URL的突发上限")
+	redirectRate := flag.Float64("redirect-rate", 100, "每个客户端IP每秒的重定向次数，0为不限")
+	redirectBurst := flag.Int("redirect-burst", 200, "重定向的突发上限")
+	dailyQuota := flag.Int("daily-quota", 10000, "每个API Key（未认证时每个IP）每天可创建的短URL数，0为不限，可在签发Key时单独设置")
+	trustedProxies := flag.String("trusted-proxies", "", "受信任的反向代理（逗号分隔的IP或CIDR），只采信来自这些地址的X-Forwarded-For")
+	shortDomains := flag.String("short-domains", "", "本服务的短域名（逗号分隔），目标URL指向这些域名或请求的Host时视为重定向循环")
+	allowedSchemes := flag.String("allowed-schemes", strings.Join(urlcheck.DefaultSchemes, ","), "目标URL允许的scheme（逗号分隔）")
+	blocklists := flag.String("blocklist", "", "拦截名单文件（逗号分隔，hosts文件或每行一个域名/URL），为空时不筛查目标URL")
+	blocklistReload := flag.Duration("blocklist-reload", 30*time.Second, "检查拦截名单文件修改的间隔，0为不自动重新加载")
+	blocklistRecheck := flag.Duration("blocklist-recheck", time.Hour, "用拦截名单重新检查已有短URL的间隔（名单变化时也会检查），0为只在启动和名单变化时检查")
+	var logCfg logging.Config
+	flag.StringVar(&logCfg.Level, "log-level", "info", "日志级别: debug, info, warn, error")
+	flag.StringVar(&logCfg.Format, "log-format", logging.FormatJSON, "日志格式: json, text")
 	flag.Parse()
 
-	log.Printf("初始化Fuxi短URL服务...")
+	if err := logging.Setup(logCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化日志失败: %v\n", err)
+		os.Exit(2)
+	}
+
+	slog.Info("starting fuxi short URL service")
 
-	// 初始化存储
 	var err error
-	store, err = storage.NewLayeredStorage(*dbPath, *cacheSize)
+
+	// 链路追踪
+	shutdownTracing, err := tracing.Setup(context.Background(), traceCfg)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+	if traceCfg.Exporter != tracing.ExporterNone {
+		slog.Info("tracing enabled", "exporter", traceCfg.Exporter, "sample_ratio", traceCfg.SampleRatio)
+	}
+
+	// 目标URL校验
+	urls, err = urlcheck.NewValidator(splitList(*allowedSchemes), splitList(*shortDomains))
+	if err != nil {
+		fatal("invalid URL validation config", err)
+	}
+
+	// 读取号池配置
+	var poolCfg *preload.Config
+	if *poolConfig != "" {
+		poolCfg, err = preload.LoadConfig(*poolConfig)
+		if err != nil {
+			fatal("failed to load pool config", err, "path", *poolConfig)
+		}
+	} else {
+		poolCfg = &preload.Config{
+			Pools: []preload.PoolConfig{{
+				Name:       "default",
+				URLFile:    *urlFile,
+				OffsetFile: *offsetFile,
+				Threshold:  *threshold,
+				BatchSize:  *batchSize,
+				Mmap:       *useMmap,
+			}},
+		}
+	}
+
+	// 各号池的短URL长度，用于在查库前拒绝不可能存在的短URL
+	var codeLengths []int
+	for _, pc := range poolCfg.Pools {
+		n := pc.CodeLength
+		if n == 0 {
+			n = preload.DefaultCodeLength
+		}
+		codeLengths = append(codeLengths, n)
+	}
+
+	// 布隆过滤器只知道本实例发放的短URL，没有失效广播时无法得知其他实例新建的短URL
+	if *bloomSize > 0 && *invalidationFile == "" {
+		slog.Warn("bloom filter enabled without an invalidation bus, only safe when this instance is the sole writer of the database",
+			"bloom_size", *bloomSize)
+	}
+
+	// 多实例缓存失效广播
+	var bus storage.InvalidationBus
+	if *invalidationFile != "" {
+		fileBus, err := storage.NewFileBus(*invalidationFile, *invalidationInterval, int64(*invalidationMaxMB)<<20)
+		if err != nil {
+			fatal("failed to open invalidation file", err, "path", *invalidationFile)
+		}
+		defer fileBus.Close()
+		bus = fileBus
+		slog.Info("cache invalidation bus enabled", "path", *invalidationFile)
+	}
+
+	// 初始化存储
+	layered, err := storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:      *dbPath,
+		CacheSize:   *cacheSize,
+		CacheBytes:  *cacheMB << 20,
+		CachePolicy: *cachePolicy,
+		NegativeTTL: *negativeTTL,
+		BloomSize:   *bloomSize,
+		CodeLengths: codeLengths,
+
+		SnapshotPath:     *snapshotPath,
+		SnapshotInterval: *snapshotInterval,
+		WarmupSize:       *warmupSize,
+
+		Redis:    redisOpts,
+		L2MaxTTL: *l2MaxTTL,
+
+		Bus: bus,
+	})
 	if err != nil {
-		log.Fatalf("初始化存储失败: %v", err)
+		fatal("failed to initialize storage", err, "db", *dbPath)
+	}
+	defer layered.Close()
+	store, keyStore = layered, layered
+
+	// 后台任务（名单复查、配额清理、自适应调整等）使用存储和号池，退出时先停止并等待它们结束，再关闭存储
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	runBackground := func(task func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			task(bgCtx)
+		}()
+	}
+
+	// 目标URL筛查，命中拦截名单的已有短URL在后台停用
+	if paths := splitList(*blocklists); len(paths) > 0 {
+		screener, err = screening.NewScreener(paths, *blocklistReload)
+		if err != nil {
+			fatal("failed to load blocklists", err, "blocklist", *blocklists)
+		}
+		defer screener.Close()
+		slog.Info("destination screening enabled", "lists", len(paths), "entries", screener.Len())
+		runBackground(screening.NewRechecker(screener, store, *blocklistRecheck).Run)
 	}
-	defer store.Close()
 
-	log.Printf("数据库: %s", *dbPath)
-	log.Printf("缓存大小: %d", *cacheSize)
+	// API Key认证
+	authn := auth.NewAuthenticator(keyStore, *authEnabled, *adminKey)
+	if !*authEnabled {
+		slog.Warn("API key authentication disabled, all endpoints are public")
+	} else if keys, err := keyStore.ListAPIKeys(); err == nil && len(keys) == 0 && *adminKey == "" {
+		slog.Warn("no API keys issued yet, set -admin-key to issue the first key")
+	}
 
-	// 初始化预加载链表
-	loader := preload.NewFileLoader(*urlFile, *offsetFile)
-	linkedURL = preload.NewLinkedURL(loader, 2000, 10000)
+	if *cacheMB > 0 {
+		slog.Info("storage ready", "db", *dbPath, "cache_mb", *cacheMB, "cache_policy", *cachePolicy)
+	} else {
+		slog.Info("storage ready", "db", *dbPath, "cache_size", *cacheSize, "cache_policy", *cachePolicy)
+	}
+	if redisOpts.Addr != "" {
+		slog.Info("l2 cache enabled", "addr", redisOpts.Addr, "redis_db", redisOpts.DB, "prefix", redisOpts.KeyPrefix)
+	}
+	if st, err := store.GetStats(); err == nil && *warmupSize > 0 {
+		slog.Info("cache warmed", "entries", st.WarmedEntries)
+	}
 
-	err = linkedURL.Init()
+	// 初始化号池
+	pools, err = preload.NewManager(poolCfg)
 	if err != nil {
-		log.Fatalf("初始化预加载链表失败: %v", err)
+		fatal("failed to create pools", err)
 	}
+	defer pools.Close()
 
-	log.Printf("预加载链表初始化完成，当前数量: %d", linkedURL.Count())
+	err = pools.Init()
+	if err != nil {
+		fatal("failed to initialize preload lists", err)
+	}
+
+	// 加载失败由预加载链表自行记录日志
+	for _, pool := range pools.Pools() {
+		slog.Info("pool ready", "pool", pool.Name, "code_length", pool.CodeLength(), "count", pool.List.Count())
+
+		// 启动自适应调整
+		if *adaptive {
+			runBackground(preload.NewTuner(pool.List, adaptiveCfg).Run)
+		}
+	}
+
+	if *adaptive {
+		slog.Info("adaptive preload enabled",
+			"min_threshold", adaptiveCfg.MinThreshold, "max_threshold", adaptiveCfg.MaxThreshold,
+			"min_batch", adaptiveCfg.MinBatch, "max_batch", adaptiveCfg.MaxBatch)
+	}
 
 	// 启动定期日志
-	go func() {
+	runBackground(func(ctx context.Context) {
 		ticker := time.NewTicker(10 * time.Second)
-		for range ticker.C {
-			count := linkedURL.Count()
-			loading := linkedURL.IsLoading()
-			log.Printf("[状态] 链表数量: %d, 加载中: %v", count, loading)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, pool := range pools.Pools() {
+				ps := pool.List.Stats()
+				slog.Info("pool status", "pool", pool.Name, "count", ps.Count, "loading", ps.Loading,
+					"threshold", ps.Threshold, "batch_size", ps.BatchSize, "acquire_rate", ps.AcquireRate)
+			}
 		}
-	}()
+	})
 
 	// 设置Gin
 	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	r := gin.New()
+	if err := r.SetTrustedProxies(splitList(*trustedProxies)); err != nil {
+		fatal("invalid trusted proxies", err, "trusted_proxies", *trustedProxies)
+	}
+	r.Use(logging.Middleware(), logging.Recovery())
+	r.Use(metricsMiddleware())
+	r.Use(tracing.Middleware("fuxi/cmd/api"))
+
+	// Prometheus指标
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
@@ -72,50 +317,163 @@ func main() {
 		})
 	})
 
-	// API路由
-	api := r.Group("/api")
+	// 限流：创建按API Key（未认证时按IP）限速并计入每日配额，重定向按IP限速
+	var createLimits, redirectLimits []gin.HandlerFunc
+	if *createRate > 0 {
+		limiter := ratelimit.NewLimiter("create", *createRate, *createBurst)
+		createLimits = append(createLimits, ratelimit.Middleware(limiter, ratelimit.KeyOrIP))
+	}
+	// 全局配额为0时，单独设置了配额的Key仍然受限
+	createLimits = append(createLimits, ratelimit.QuotaMiddleware(layered, quotaSubject(*dailyQuota)))
+	runBackground(func(ctx context.Context) { pruneQuotas(ctx, layered) })
+	if *redirectRate > 0 {
+		limiter := ratelimit.NewLimiter("redirect", *redirectRate, *redirectBurst)
+		redirectLimits = append(redirectLimits, ratelimit.Middleware(limiter, ratelimit.KeyOrIP))
+	}
+
+	// API路由，均需API Key；短URL只能由创建它的Key（或管理员Key）管理
+	api := r.Group("/api", authn.Middleware())
 	{
-		api.POST("/shorten", handleShorten)
-		api.GET("/stats", handleStats)
+		api.POST("/shorten", append(createLimits, handleShorten)...)
+		api.GET("/links", handleListLinks)
+		api.GET("/links/:code", handleGetLink)
+		api.PUT("/links/:code", handleUpdateLink)
+		api.PUT("/links/:code/rules", handleUpdateRules)
+		api.DELETE("/links/:code", handleDeleteLink)
+		api.GET("/stats", auth.RequireAdmin(), handleStats)
+	}
+
+	// 管理接口：签发和吊销API Key，停用和恢复短URL
+	admin := api.Group("/admin", auth.RequireAdmin())
+	{
+		admin.POST("/keys", handleCreateKey)
+		admin.GET("/keys", handleListKeys)
+		admin.DELETE("/keys/:id", handleRevokeKey)
+		admin.POST("/links/:code/disable", handleDisableLink)
+		admin.POST("/links/:code/enable", handleEnableLink)
 	}
 
 	// 短URL重定向
-	r.GET("/:code", handleRedirect)
+	redirects := redirect.NewHandler(store, *permanentMaxAge)
+	redirects.Register(r, redirectLimits...)
 
 	// 启动服务器
 	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("服务器启动在 http://localhost%s", addr)
-	log.Printf("API文档:")
-	log.Printf("  POST http://localhost%s/api/shorten - 生成短URL", addr)
-	log.Printf("  GET  http://localhost%s/api/stats   - 统计信息", addr)
-	log.Printf("  GET  http://localhost%s/:code       - 短URL重定向", addr)
+	slog.Info("server listening", "addr", addr)
+
+	// 收到退出信号后停止接收请求，等处理中的请求、访问计数和后台任务结束后才返回，
+	// 之后defer中关闭号池和存储，关闭存储时写入最后一次热点快照
+	server := &http.Server{Addr: addr, Handler: r}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
 
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("启动服务器失败: %v", err)
+		slog.Info("shutting down server")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("failed to shut down server gracefully", "error", err)
+		}
+	}()
+
+	// Shutdown开始后ListenAndServe立即返回ErrServerClosed，需等待Shutdown完成
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fatal("server failed", err)
 	}
+	<-shutdownDone
+	redirects.Wait()
+	stopBackground()
+	background.Wait()
+	slog.Info("server stopped")
 }
 
 // handleShorten 生成短URL
 func handleShorten(c *gin.Context) {
 	var req struct {
-		LongURL string `json:"long_url" binding:"required"`
+		LongURL      string `json:"long_url"` // 为空时由normalizeURL返回empty_url
+		Pool         string `json:"pool"`
+		Interstitial bool   `json:"interstitial"`  // 访问时总是先显示预览页
+		RedirectType int    `json:"redirect_type"` // 301、302、307、308，默认302
+		ForwardQuery bool   `json:"forward_query"` // 把访问时的查询参数合并到目标URL
+		ForwardPath  bool   `json:"forward_path"`  // 把短URL之后的路径追加到目标URL
+
+		UTM   storage.UTMParams `json:"utm"`   // 目标URL和访问参数中没有时添加的UTM参数
+		Rules []storage.Rule    `json:"rules"` // 条件跳转规则，都不匹配时跳转到long_url
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": "long_url is required"})
+		c.JSON(400, gin.H{"error": err.Error(), "code": codeMalformedRequest})
+		return
+	}
+	if req.RedirectType != 0 && !storage.ValidRedirectType(req.RedirectType) {
+		c.JSON(400, gin.H{"error": "redirect_type must be one of 301, 302, 307, 308", "code": codeInvalidRedirectType})
+		return
+	}
+	for _, p := range req.UTM.Params() {
+		if len(p[1]) > 255 {
+			c.JSON(400, gin.H{"error": p[0] + " must be at most 255 bytes", "code": codeInvalidUTM})
+			return
+		}
+	}
+
+	// 在取号前校验目标URL，避免无效请求消耗短URL
+	longURL, ok := normalizeURL(c, req.LongURL)
+	if !ok || !normalizeRules(c, req.Rules) {
 		return
 	}
 
-	// 从预加载链表获取短URL
-	code, err := linkedURL.Acquire()
+	// 号池由已认证的API Key决定，只有管理员Key可以通过pool字段指定其他号池
+	key := auth.Key(c)
+	pool, err := pools.Route(key.Pool)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "failed to generate short URL"})
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "API key is bound to an unknown pool"})
 		return
 	}
+	if req.Pool != "" && req.Pool != pool.Name {
+		if !key.Admin {
+			c.JSON(403, gin.H{"error": "pool not allowed for this API key"})
+			return
+		}
+		if pool, err = pools.Route(req.Pool); err != nil {
+			c.JSON(400, gin.H{"error": "unknown pool"})
+			return
+		}
+	}
 
-	// 保存到存储
-	err = store.Save(code, req.LongURL)
+	// 从预加载链表获取短URL，链表暂时为空时等待补充
+	ctx, cancel := context.WithTimeout(c.Request.Context(), acquireTimeout)
+	code, err := pool.List.AcquireContext(ctx)
+	cancel()
+	if err != nil {
+		retryAfter := "1"
+		if errors.Is(err, preload.ErrPoolExhausted) {
+			retryAfter = "60"
+		}
+		c.Error(err)
+		c.Header("Retry-After", retryAfter)
+		c.JSON(503, gin.H{"error": "short URL pool temporarily unavailable"})
+		return
+	}
+
+	// 保存到存储，归属于当前API Key
+	mapping := &storage.URLMapping{
+		ShortCode:    code,
+		LongURL:      longURL,
+		OwnerID:      auth.Key(c).ID,
+		Interstitial: req.Interstitial,
+		RedirectType: req.RedirectType,
+		ForwardQuery: req.ForwardQuery,
+		ForwardPath:  req.ForwardPath,
+		UTM:          req.UTM,
+		Rules:        req.Rules,
+	}
+	err = store.SaveMapping(c.Request.Context(), mapping)
 	if err != nil {
+		c.Error(err)
 		c.JSON(500, gin.H{"error": "failed to save mapping"})
 		return
 	}
@@ -123,44 +481,377 @@ func handleShorten(c *gin.Context) {
 	shortURL := fmt.Sprintf("http://%s/%s", c.Request.Host, code)
 
 	c.JSON(200, gin.H{
-		"short_code": code,
-		"short_url":  shortURL,
-		"long_url":   req.LongURL,
+		"short_code":    code,
+		"short_url":     shortURL,
+		"long_url":      longURL,
+		"pool":          pool.Name,
+		"interstitial":  req.Interstitial,
+		"redirect_type": mapping.RedirectType,
+		"forward_query": req.ForwardQuery,
+		"forward_path":  req.ForwardPath,
+		"utm":           req.UTM,
+		"rules":         rulesJSON(req.Rules),
+	})
+}
+
+// handleListLinks 分页列出当前API Key创建的短URL
+func handleListLinks(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(400, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	mappings, total, err := store.ListMappings(auth.Key(c).ID, limit, offset)
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to list links"})
+		return
+	}
+
+	links := make([]gin.H, 0, len(mappings))
+	for i := range mappings {
+		links = append(links, linkJSON(&mappings[i]))
+	}
+	c.JSON(200, gin.H{
+		"links":  links,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
 	})
 }
 
-// handleRedirect 短URL重定向
-func handleRedirect(c *gin.Context) {
+// handleGetLink 查看短URL详情，非管理员只能查看自己创建的
+func handleGetLink(c *gin.Context) {
+	mapping, err := store.GetMapping(c.Param("code"))
+	if key := auth.Key(c); err == nil && !key.Admin && mapping.OwnerID != key.ID {
+		err = storage.ErrNotFound
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to look up short URL"})
+		return
+	}
+
+	c.JSON(200, linkJSON(mapping))
+}
+
+// rulesJSON 规则的响应格式，没有规则时返回空数组而不是null
+func rulesJSON(rules []storage.Rule) []storage.Rule {
+	if rules == nil {
+		return []storage.Rule{}
+	}
+	return rules
+}
+
+// linkJSON 短URL详情的响应格式
+func linkJSON(m *storage.URLMapping) gin.H {
+	link := gin.H{
+		"short_code":    m.ShortCode,
+		"long_url":      m.LongURL,
+		"access_count":  m.AccessCount,
+		"owner_id":      m.OwnerID,
+		"interstitial":  m.Interstitial,
+		"redirect_type": m.RedirectType,
+		"forward_query": m.ForwardQuery,
+		"forward_path":  m.ForwardPath,
+		"utm":           m.UTM,
+		"rules":         rulesJSON(m.Rules),
+		"created_at":    m.CreatedAt.Format(time.RFC3339),
+		"expires_at":    m.ExpiresAt.Format(time.RFC3339),
+	}
+	if m.DisabledAt != nil {
+		link["disabled_reason"] = m.DisabledReason
+		link["disabled_at"] = m.DisabledAt.Format(time.RFC3339)
+	}
+	if m.ReviewedAt != nil {
+		link["reviewed_at"] = m.ReviewedAt.Format(time.RFC3339)
+	}
+	return link
+}
+
+// handleUpdateRules 替换短URL的条件跳转规则，fallback_url为规则都不匹配时的目标地址
+func handleUpdateRules(c *gin.Context) {
+	var req struct {
+		FallbackURL string         `json:"fallback_url"`
+		Rules       []storage.Rule `json:"rules"` // 为空时清除规则
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": codeMalformedRequest})
+		return
+	}
+	if strings.TrimSpace(req.FallbackURL) == "" {
+		c.JSON(400, gin.H{"error": "fallback_url is required", "code": urlcheck.CodeEmpty})
+		return
+	}
+	fallbackURL, ok := normalizeURL(c, req.FallbackURL)
+	if !ok || !normalizeRules(c, req.Rules) {
+		return
+	}
+
 	code := c.Param("code")
+	var err error
+	if key := auth.Key(c); key.Admin {
+		err = store.UpdateRules(code, fallbackURL, req.Rules)
+	} else {
+		err = store.UpdateRulesOwned(key.ID, code, fallbackURL, req.Rules)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to update rules"})
+		return
+	}
 
-	// 查询长URL
-	longURL, err := store.Get(code)
+	c.JSON(200, gin.H{
+		"short_code":   code,
+		"fallback_url": fallbackURL,
+		"rules":        rulesJSON(req.Rules),
+	})
+}
+
+// handleUpdateLink 修改短URL的目标地址
+func handleUpdateLink(c *gin.Context) {
+	var req struct {
+		LongURL string `json:"long_url"` // 为空时由normalizeURL返回empty_url
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": codeMalformedRequest})
+		return
+	}
+	longURL, ok := normalizeURL(c, req.LongURL)
+	if !ok {
+		return
+	}
+
+	code := c.Param("code")
+	var err error
+	if key := auth.Key(c); key.Admin {
+		err = store.Update(code, longURL)
+	} else {
+		err = store.UpdateOwned(key.ID, code, longURL)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
 	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to update mapping"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"short_code": code,
+		"long_url":   longURL,
+	})
+}
+
+// handleDisableLink 手动停用短URL（如收到滥用举报），重定向改为返回警告页
+func handleDisableLink(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "reason is required"})
+		return
+	}
+	setLinkDisabled(c, func(code string) error {
+		return store.DisableMapping(code, req.Reason)
+	})
+}
+
+// handleEnableLink 恢复被停用的短URL（如拦截名单误报），后台检查不再停用它，直到目标地址被修改
+func handleEnableLink(c *gin.Context) {
+	setLinkDisabled(c, store.EnableMapping)
+}
+
+// setLinkDisabled 修改停用状态并返回修改后的短URL详情
+func setLinkDisabled(c *gin.Context, update func(code string) error) {
+	code := c.Param("code")
+	err := update(code)
+	if errors.Is(err, storage.ErrNotFound) {
 		c.JSON(404, gin.H{"error": "short URL not found"})
 		return
 	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to update mapping"})
+		return
+	}
 
-	// 增加访问计数（异步）
-	go store.IncrementAccess(code)
+	mapping, err := store.GetMapping(code)
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to look up short URL"})
+		return
+	}
+	c.JSON(200, linkJSON(mapping))
+}
+
+// handleDeleteLink 删除短URL
+func handleDeleteLink(c *gin.Context) {
+	var err error
+	if key := auth.Key(c); key.Admin {
+		err = store.Delete(c.Param("code"))
+	} else {
+		err = store.DeleteOwned(key.ID, c.Param("code"))
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to delete mapping"})
+		return
+	}
 
-	// 302重定向
-	c.Redirect(http.StatusFound, longURL)
+	c.Status(http.StatusNoContent)
 }
 
 // handleStats 统计信息
 func handleStats(c *gin.Context) {
 	stats, err := store.GetStats()
 	if err != nil {
+		c.Error(err)
 		c.JSON(500, gin.H{"error": "failed to get stats"})
 		return
 	}
 
+	ps := pools.Default().List.Stats()
+
+	poolStats := gin.H{}
+	for _, pool := range pools.Pools() {
+		st := pool.List.Stats()
+		poolStats[pool.Name] = gin.H{
+			"code_length":       pool.CodeLength(),
+			"count":             st.Count,
+			"threshold":         st.Threshold,
+			"batch_size":        st.BatchSize,
+			"acquire_rate":      st.AcquireRate,
+			"refill_latency_ms": float64(st.RefillLatency.Microseconds()) / 1000,
+			"error":             errorString(pool.List.LastError()),
+		}
+	}
+
 	c.JSON(200, gin.H{
-		"total_urls":     stats.TotalURLs,
-		"active_urls":    stats.ActiveURLs,
-		"expired_urls":   stats.ExpiredURLs,
-		"total_access":   stats.TotalAccess,
-		"cache_hit_rate": fmt.Sprintf("%.2f%%", stats.CacheHitRate*100),
-		"preload_count":  linkedURL.Count(),
+		"total_urls":                stats.TotalURLs,
+		"active_urls":               stats.ActiveURLs,
+		"expired_urls":              stats.ExpiredURLs,
+		"total_access":              stats.TotalAccess,
+		"cache_hit_rate":            stats.CacheHitRate,
+		"cache_hit_rate_1m":         stats.CacheHitRate1m,
+		"cache_hit_rate_5m":         stats.CacheHitRate5m,
+		"cache_hit_rate_15m":        stats.CacheHitRate15m,
+		"cache_size":                stats.CacheSize,
+		"cache_bytes":               stats.CacheBytes,
+		"cache_hits":                stats.CacheHits,
+		"cache_misses":              stats.CacheMisses,
+		"cache_insertions":          stats.CacheInsertions,
+		"cache_evictions":           stats.CacheEvictions,
+		"cache_hit_latency_us":      latencyMicros(stats.CacheHitLatency),
+		"fallback_latency_us":       latencyMicros(stats.FallbackLatency),
+		"fallback_lookups":          stats.FallbackLatency.Count,
+		"l2_latency_us":             latencyMicros(stats.L2Latency),
+		"db_latency_us":             latencyMicros(stats.DBLatency),
+		"db_queries":                stats.DBLatency.Count,
+		"negative_hits":             stats.NegativeHits,
+		"invalid_codes":             stats.InvalidCodes,
+		"coalesced_lookups":         stats.CoalescedLookups,
+		"warmed_entries":            stats.WarmedEntries,
+		"snapshot_error":            stats.SnapshotError,
+		"l2_hits":                   stats.L2Hits,
+		"l2_misses":                 stats.L2Misses,
+		"l2_errors":                 stats.L2Errors,
+		"invalidations":             stats.Invalidations,
+		"invalidation_errors":       stats.InvalidationErrors,
+		"preload_count":             ps.Count,
+		"preload_threshold":         ps.Threshold,
+		"preload_batch_size":        ps.BatchSize,
+		"preload_acquire_rate":      ps.AcquireRate,
+		"preload_refill_latency_ms": float64(ps.RefillLatency.Microseconds()) / 1000,
+		"preload_error":             errorString(pools.Default().List.LastError()),
+		"pools":                     poolStats,
 	})
 }
+
+// normalizeURL 校验并规范化目标URL，再用拦截名单筛查，失败时返回400和错误码
+func normalizeURL(c *gin.Context, raw string) (string, bool) {
+	longURL, err := urls.Normalize(raw, c.Request.Host)
+	var verr *urlcheck.Error
+	if errors.As(err, &verr) {
+		c.JSON(400, gin.H{"error": verr.Message, "code": verr.Code})
+		return "", false
+	}
+
+	if screener != nil {
+		if match, blocked := screener.Check(longURL); blocked {
+			slog.WarnContext(c.Request.Context(), "blocklisted destination rejected", "long_url", longURL,
+				"list", match.List, "entry", match.Entry, "key_id", auth.Key(c).ID)
+			c.JSON(400, gin.H{"error": "destination is on a blocklist", "code": codeBlocked})
+			return "", false
+		}
+	}
+	return longURL, true
+}
+
+// normalizeRules 检查规则条件，并像长URL一样校验和规范化每条规则的目标URL；失败时已写入400响应
+func normalizeRules(c *gin.Context, rules []storage.Rule) bool {
+	if err := redirect.ValidateRules(rules); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": codeInvalidRule})
+		return false
+	}
+	for i := range rules {
+		ruleURL, ok := normalizeURL(c, rules[i].URL)
+		if !ok {
+			return false
+		}
+		rules[i].URL = ruleURL
+	}
+	return true
+}
+
+// splitList 拆分逗号分隔的命令行参数，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// fatal 记录启动失败的错误并退出
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"error", err}, args...)...)
+	os.Exit(1)
+}
+
+// latencyMicros 返回平均耗时（微秒）
+func latencyMicros(l storage.Latency) float64 {
+	return float64(l.Mean().Nanoseconds()) / 1000
+}
+
+// errorString 返回错误信息，nil时为空字符串
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fuxi/internal/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTP请求指标，按路由模板（而不是实际路径）区分，避免短URL造成标签爆炸
+var (
+	httpRequests = metrics.NewCounterVec("fuxi_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "status")
+	httpDuration = metrics.NewHistogramVec("fuxi_http_request_duration_seconds",
+		"HTTP request latency by route and method.", metrics.DefBuckets, "route", "method")
+)
+
+// metricsMiddleware 记录每个请求的路由、状态码和耗时
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.With(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.With(route, method).Observe(time.Since(start).Seconds())
+	}
+}
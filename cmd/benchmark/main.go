@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -26,10 +28,14 @@ type Result struct {
 	QPS           float64
 }
 
+// apiKey 调用/api接口时使用的API Key，统计接口需要管理员Key
+var apiKey string
+
 func main() {
 	apiURL := flag.String("url", "http://localhost:8080", "API服务地址")
 	concurrent := flag.Int("c", 100, "并发数")
 	requests := flag.Int("n", 10000, "总请求数")
+	flag.StringVar(&apiKey, "api-key", os.Getenv("FUXI_API_KEY"), "API Key（默认读取FUXI_API_KEY）")
 	flag.Parse()
 
 	log.Printf("=== Fuxi 性能测试 ===")
@@ -84,11 +90,7 @@ func benchmarkCreate(apiURL string, concurrent, requests int) *Result {
 				jsonData, _ := json.Marshal(reqData)
 				reqStart := time.Now()
 
-				resp, err := client.Post(
-					apiURL+"/api/shorten",
-					"application/json",
-					bytes.NewBuffer(jsonData),
-				)
+				resp, err := client.Do(newAPIRequest(http.MethodPost, apiURL+"/api/shorten", bytes.NewBuffer(jsonData)))
 
 				latency := time.Since(reqStart)
 
@@ -125,11 +127,7 @@ func benchmarkRedirect(apiURL string, concurrent, requests int) *Result {
 		}
 		jsonData, _ := json.Marshal(reqData)
 
-		resp, err := client.Post(
-			apiURL+"/api/shorten",
-			"application/json",
-			bytes.NewBuffer(jsonData),
-		)
+		resp, err := client.Do(newAPIRequest(http.MethodPost, apiURL+"/api/shorten", bytes.NewBuffer(jsonData)))
 
 		if err == nil && resp.StatusCode == 200 {
 			var result map[string]interface{}
@@ -175,7 +173,7 @@ func benchmarkRedirect(apiURL string, concurrent, requests int) *Result {
 				resp, err := noRedirectClient.Get(apiURL + "/" + code)
 				latency := time.Since(reqStart)
 
-				if err != nil || (resp.StatusCode != 302 && resp.StatusCode != 301) {
+				if err != nil || !isRedirect(resp.StatusCode) {
 					atomic.AddInt64(&failureCount, 1)
 				} else {
 					atomic.AddInt64(&successCount, 1)
@@ -256,12 +254,16 @@ func printResult(result *Result) {
 }
 
 func printStats(apiURL string) {
-	resp, err := http.Get(apiURL + "/api/stats")
+	resp, err := http.DefaultClient.Do(newAPIRequest(http.MethodGet, apiURL+"/api/stats", nil))
 	if err != nil {
 		log.Printf("获取统计失败: %v", err)
 		return
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("获取统计失败: HTTP %d（统计接口需要管理员API Key）", resp.StatusCode)
+		return
+	}
 
 	var stats map[string]interface{}
 	json.NewDecoder(resp.Body).Decode(&stats)
@@ -269,6 +271,30 @@ func printStats(apiURL string) {
 	log.Printf("总URL数: %.0f", stats["total_urls"])
 	log.Printf("活跃URL: %.0f", stats["active_urls"])
 	log.Printf("总访问量: %.0f", stats["total_access"])
-	log.Printf("缓存命中率: %v", stats["cache_hit_rate"])
+	hitRate, _ := stats["cache_hit_rate"].(float64)
+	hitRate1m, _ := stats["cache_hit_rate_1m"].(float64)
+	log.Printf("缓存命中率: %.2f%% (最近1分钟 %.2f%%)", hitRate*100, hitRate1m*100)
 	log.Printf("预加载数量: %.0f", stats["preload_count"])
 }
+
+// newAPIRequest 创建带API Key的JSON请求
+func newAPIRequest(method, url string, body io.Reader) *http.Request {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		log.Fatalf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return req
+}
+
+// isRedirect 短URL可以设置为301、302、307或308重定向
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
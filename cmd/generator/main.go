@@ -5,6 +5,7 @@ import (
 	"fuxi/internal/generator"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -13,15 +14,18 @@ func main() {
 	count := flag.Int("count", 1000000, "生成短URL的数量")
 	output := flag.String("output", "data/shorturls.dat", "输出文件路径")
 	bloomSize := flag.Int("bloom", 10000000, "布隆过滤器大小")
+	length := flag.Int("length", generator.DefaultLength, "短URL长度")
+	offsetFile := flag.String("offset", "data/offset.dat", "偏移量文件路径")
 	flag.Parse()
 
 	log.Printf("开始生成 %d 条短URL...\n", *count)
 	log.Printf("布隆过滤器大小: %d\n", *bloomSize)
+	log.Printf("短URL长度: %d\n", *length)
 
 	startTime := time.Now()
 
 	// 创建生成器
-	gen := generator.NewGenerator(*bloomSize)
+	gen := generator.NewGeneratorWithLength(*bloomSize, *length)
 
 	// 生成短URL
 	urls, err := gen.Generate(*count)
@@ -34,7 +38,7 @@ func main() {
 	log.Printf("平均速度: %.0f URLs/秒\n", float64(*count)/generateTime.Seconds())
 
 	// 确保输出目录存在
-	os.MkdirAll("data", 0755)
+	os.MkdirAll(filepath.Dir(*output), 0755)
 
 	// 写入文件
 	log.Printf("写入文件: %s\n", *output)
@@ -58,15 +62,14 @@ func main() {
 	log.Printf("文件大小: %.2f MB\n", sizeMB)
 
 	// 创建偏移量文件
-	offsetFile := "data/offset.dat"
-	offset, err := os.Create(offsetFile)
+	offset, err := os.Create(*offsetFile)
 	if err != nil {
 		log.Fatalf("创建偏移量文件失败: %v", err)
 	}
 	offset.WriteString("0")
 	offset.Close()
 
-	log.Printf("偏移量文件: %s\n", offsetFile)
+	log.Printf("偏移量文件: %s\n", *offsetFile)
 
 	totalTime := time.Since(startTime)
 	log.Printf("\n=== 总结 ===")
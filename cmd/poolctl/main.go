@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"fuxi/internal/preload"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `poolctl - 号池检查与维护工具
+
+用法:
+  poolctl status [-urls F] [-offset F] [-length N] [-rate R | -api URL [-api-key K] | -sample D]
+  poolctl verify [-urls F] [-offset F] [-length N]
+  poolctl rewind [-urls F] [-offset F] [-length N] (-n N | -to I) -force
+  poolctl skip   [-urls F] [-offset F] [-length N] -n N
+  poolctl merge  [-length N] [-force] -out F [-out-offset F] input.dat[@input.offset] ...
+`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "status":
+		err = runStatus(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "rewind":
+		err = runRewind(os.Args[2:])
+	case "skip":
+		err = runSkip(os.Args[2:])
+	case "merge":
+		err = runMerge(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("%s失败: %v", os.Args[1], err)
+	}
+}
+
+// poolFlags 各子命令共用的号池参数
+type poolFlags struct {
+	urlFile    string
+	offsetFile string
+	length     int
+}
+
+func (p *poolFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.urlFile, "urls", "data/shorturls.dat", "短URL文件路径")
+	fs.StringVar(&p.offsetFile, "offset", "data/offset.dat", "偏移量文件路径")
+	fs.IntVar(&p.length, "length", preload.DefaultCodeLength, "短URL长度")
+}
+
+// pool 返回参数指定的号池
+func (p *poolFlags) pool() preload.PoolFile {
+	return preload.PoolFile{URLFile: p.urlFile, OffsetFile: p.offsetFile, Length: p.length}
+}
+
+// runStatus 输出号池总量、已消费、剩余和预计可用天数
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var p poolFlags
+	p.register(fs)
+	rate := fs.Float64("rate", 0, "消费速率（个/秒）")
+	apiURL := fs.String("api", "", "从运行中的API服务读取消费速率，如 http://localhost:8080")
+	pool := fs.String("pool", "default", "配合-api使用的号池名称")
+	apiKey := fs.String("api-key", os.Getenv("FUXI_ADMIN_KEY"), "配合-api使用的管理员API Key（默认读取FUXI_ADMIN_KEY）")
+	sample := fs.Duration("sample", 0, "观察偏移量变化的时长，用于估算消费速率")
+	fs.Parse(args)
+
+	st, err := p.pool().Status()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *rate > 0:
+	case *apiURL != "":
+		*rate, err = fetchRate(*apiURL, *apiKey, *pool)
+		if err != nil {
+			return err
+		}
+	case *sample > 0:
+		time.Sleep(*sample)
+		later, err := preload.ReadOffset(p.offsetFile)
+		if err != nil {
+			return err
+		}
+		*rate = float64(later-st.Offset) / float64(p.length) / sample.Seconds()
+	}
+
+	fmt.Printf("号池文件:   %s\n", p.urlFile)
+	fmt.Printf("短URL长度:  %d\n", p.length)
+	fmt.Printf("总量:       %d\n", st.Total)
+	fmt.Printf("已消费:     %d (%.2f%%)\n", st.Consumed, percent(st.Consumed, st.Total))
+	fmt.Printf("剩余:       %d\n", st.Remaining)
+	if *rate > 0 {
+		days := float64(st.Remaining) / *rate / 86400
+		fmt.Printf("消费速率:   %.2f 个/秒\n", *rate)
+		fmt.Printf("预计可用:   %.1f 天\n", days)
+	} else {
+		fmt.Printf("预计可用:   未知（使用 -rate、-api 或 -sample 估算）\n")
+	}
+	if !st.Aligned(p.length) {
+		fmt.Printf("警告: 偏移量 %d 未对齐到短URL长度 %d\n", st.Offset, p.length)
+	}
+	return nil
+}
+
+// fetchRate 从API服务的 /api/stats 读取号池消费速率，统计接口需要管理员Key
+func fetchRate(apiURL, apiKey, pool string) (float64, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(apiURL, "/")+"/api/stats", nil)
+	if err != nil {
+		return 0, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("stats request failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var stats struct {
+		Pools map[string]struct {
+			AcquireRate float64 `json:"acquire_rate"`
+		} `json:"pools"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("failed to decode stats: %w", err)
+	}
+
+	ps, ok := stats.Pools[pool]
+	if !ok {
+		return 0, fmt.Errorf("pool %q not found in stats", pool)
+	}
+	return ps.AcquireRate, nil
+}
+
+// runVerify 检查重复、字符集和长度对齐
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var p poolFlags
+	p.register(fs)
+	fs.Parse(args)
+
+	report, err := p.pool().Verify()
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("检查完成: %d 个短URL，重复 %d，非法字符 %d\n", report.Codes, report.Duplicates, report.Invalid)
+	if !report.OK() {
+		return fmt.Errorf("found %d problems", report.Count())
+	}
+	return nil
+}
+
+// runRewind 回退偏移量（会重新发放已消费的短URL，需要 -force）
+func runRewind(args []string) error {
+	fs := flag.NewFlagSet("rewind", flag.ExitOnError)
+	var p poolFlags
+	p.register(fs)
+	n := fs.Int64("n", 0, "回退的短URL数量")
+	to := fs.Int64("to", -1, "回退到第几个短URL（从0开始）")
+	force := fs.Bool("force", false, "确认回退：已发放的短URL可能被重复使用")
+	fs.Parse(args)
+
+	if !*force && (*n > 0 || *to >= 0) {
+		return fmt.Errorf("rewind may reissue codes that are already in use, pass -force to confirm")
+	}
+	from, target, err := p.pool().Rewind(*n, *to)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("偏移量: %d -> %d（第 %d 个短URL）\n", from, target, target/int64(p.length))
+	return nil
+}
+
+// runSkip 跳过指定数量的短URL
+func runSkip(args []string) error {
+	fs := flag.NewFlagSet("skip", flag.ExitOnError)
+	var p poolFlags
+	p.register(fs)
+	n := fs.Int64("n", 0, "跳过的短URL数量")
+	fs.Parse(args)
+
+	from, target, err := p.pool().Skip(*n)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("偏移量: %d -> %d（第 %d 个短URL）\n", from, target, target/int64(p.length))
+	return nil
+}
+
+// runMerge 合并多个号池未消费的部分并去重，输入写作 file@offset，合并后输入被标记为已消费
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	length := fs.Int("length", preload.DefaultCodeLength, "短URL长度")
+	out := fs.String("out", "", "输出号池文件")
+	outOffset := fs.String("out-offset", "", "输出偏移量文件（默认为输出文件加 .offset）")
+	force := fs.Bool("force", false, "允许没有偏移量文件的输入：确认没有服务从这些文件取号")
+	fs.Parse(args)
+
+	if *out == "" || fs.NArg() == 0 {
+		return fmt.Errorf("-out and at least one input are required")
+	}
+	if *outOffset == "" {
+		*outOffset = *out + ".offset"
+	}
+
+	var inputs []preload.PoolFile
+	for _, input := range fs.Args() {
+		urlFile, offsetFile, _ := strings.Cut(input, "@")
+		inputs = append(inputs, preload.PoolFile{URLFile: urlFile, OffsetFile: offsetFile, Length: *length})
+	}
+
+	result, err := preload.Merge(inputs, *out, *outOffset, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("合并完成: 读取 %d，写入 %d，去重 %d，跳过已消费 %d -> %s (偏移量 %s)\n",
+		result.Read, result.Written, result.Duplicates, result.Issued, *out, *outOffset)
+	fmt.Println("输入号池的偏移量已推进到文件末尾，不会再发放已合并的短URL")
+	return nil
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
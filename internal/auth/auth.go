@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fuxi/internal/storage"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey gin.Context中保存已认证API Key的键
+const contextKey = "fuxi.api_key"
+
+// BootstrapAdmin 引导管理员Key和关闭认证时使用的虚拟记录，ID为0，创建的短URL无归属
+var BootstrapAdmin = &storage.APIKey{Name: "bootstrap-admin", Admin: true}
+
+// Authenticator 校验Authorization请求头中的API Key
+type Authenticator struct {
+	keys      storage.APIKeyStore
+	enabled   bool   // 关闭时所有请求都按管理员处理，仅用于本地开发
+	adminHash string // 引导管理员Key的哈希，用于签发第一批Key
+}
+
+// NewAuthenticator 创建认证器，adminKey为空时不启用引导管理员Key
+func NewAuthenticator(keys storage.APIKeyStore, enabled bool, adminKey string) *Authenticator {
+	a := &Authenticator{keys: keys, enabled: enabled}
+	if adminKey != "" {
+		a.adminHash = storage.HashAPIKey(adminKey)
+	}
+	return a
+}
+
+// Enabled 返回是否要求API Key
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Middleware 要求请求携带有效的API Key（Authorization: Bearer <key>）
+//
+// 缺少或无效的Key返回401并带WWW-Authenticate头，认证结果通过Key(c)获取。
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled {
+			c.Set(contextKey, BootstrapAdmin)
+			c.Next()
+			return
+		}
+
+		raw, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="fuxi"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing API key"})
+			return
+		}
+
+		if a.adminHash != "" && subtle.ConstantTimeCompare([]byte(storage.HashAPIKey(raw)), []byte(a.adminHash)) == 1 {
+			c.Set(contextKey, BootstrapAdmin)
+			c.Next()
+			return
+		}
+
+		key, err := a.keys.AuthenticateAPIKey(raw)
+		if errors.Is(err, storage.ErrInvalidAPIKey) {
+			c.Header("WWW-Authenticate", `Bearer realm="fuxi", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+		if err != nil {
+			c.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to authenticate"})
+			return
+		}
+
+		c.Set(contextKey, key)
+		c.Next()
+	}
+}
+
+// RequireAdmin 要求已认证的Key具有管理员权限，需放在Middleware之后
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := Key(c); key == nil || !key.Admin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API key required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Key 返回当前请求已认证的API Key，未经过Middleware时为nil
+func Key(c *gin.Context) *storage.APIKey {
+	v, _ := c.Get(contextKey)
+	key, _ := v.(*storage.APIKey)
+	return key
+}
+
+// bearerToken 解析 "Bearer <token>"，scheme不区分大小写
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
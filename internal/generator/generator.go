@@ -3,12 +3,26 @@ package generator
 import (
 	"crypto/rand"
 	"fmt"
+	"strings"
 	"sync"
 )
 
 // Base64字符集（URL安全版本）
 const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
 
+// IsValidCode 检查短URL是否只包含字符集中的字符
+func IsValidCode(code string) bool {
+	if code == "" {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(charset, code[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // BloomFilter 简单的布隆过滤器实现
 type BloomFilter struct {
 	bits []bool
@@ -62,15 +76,25 @@ func simpleHash(s string, seed int) int {
 	return hash
 }
 
+// DefaultLength 默认短URL长度
+const DefaultLength = 6
+
 // Generator 短URL生成器
 type Generator struct {
-	bf *BloomFilter
+	bf     *BloomFilter
+	length int
 }
 
 // NewGenerator 创建生成器
 func NewGenerator(bloomSize int) *Generator {
+	return NewGeneratorWithLength(bloomSize, DefaultLength)
+}
+
+// NewGeneratorWithLength 创建生成指定长度短URL的生成器
+func NewGeneratorWithLength(bloomSize, length int) *Generator {
 	return &Generator{
-		bf: NewBloomFilter(bloomSize),
+		bf:     NewBloomFilter(bloomSize),
+		length: length,
 	}
 }
 
@@ -100,14 +124,14 @@ func (g *Generator) Generate(count int) ([]string, error) {
 	return urls, nil
 }
 
-// generateOne 生成单个短URL（6个字符）
+// generateOne 生成单个短URL（默认6个字符）
 func (g *Generator) generateOne() string {
 	// 使用crypto/rand生成高质量随机数
-	bytes := make([]byte, 6)
+	bytes := make([]byte, g.length)
 	rand.Read(bytes)
 
-	result := make([]byte, 6)
-	for i := 0; i < 6; i++ {
+	result := make([]byte, g.length)
+	for i := 0; i < g.length; i++ {
 		result[i] = charset[int(bytes[i])%64]
 	}
 
@@ -1,10 +1,25 @@
 package preload
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"fuxi/internal/tracing"
+	"io"
+	"log/slog"
 	"os"
 	"sync"
-	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrNoURLs 链表中暂无可用短URL（通常是补充加载尚未完成）
+	ErrNoURLs = errors.New("no URLs available")
+	// ErrPoolExhausted 短URL文件已全部消费
+	ErrPoolExhausted = errors.New("short URL pool exhausted")
 )
 
 // URLNode 短URL链表节点
@@ -23,13 +38,45 @@ type LinkedURL struct {
 	loader    *FileLoader // 文件加载器
 	mu        sync.Mutex  // 互斥锁
 	loading   bool        // 是否正在加载
+
+	refilled   chan struct{} // 每次加载结束时关闭，用于唤醒等待者
+	lastErr    error         // 最近一次加载的错误
+	lastLoaded int           // 最近一次加载的短URL数量
+	errCh      chan error    // 加载错误通知
+
+	acquired      int64         // 累计获取数量
+	acquireRate   float64       // 获取速率（个/秒），由Tuner更新
+	refillLatency time.Duration // 加载耗时（指数加权平均）
+
+	name    string      // 号池名称，用于指标和链路追踪
+	metrics listMetrics // Prometheus子指标
+}
+
+// Stats 预加载链表状态
+type Stats struct {
+	Count         int           // 当前节点数量
+	Threshold     int           // 触发加载的阈值
+	BatchSize     int           // 每次加载的数量
+	Loading       bool          // 是否正在加载
+	Acquired      int64         // 累计获取数量
+	AcquireRate   float64       // 获取速率（个/秒）
+	RefillLatency time.Duration // 加载耗时（指数加权平均）
 }
 
+// DefaultCodeLength 短URL文件中每个短URL的默认字节数
+const DefaultCodeLength = 6
+
 // FileLoader 文件加载器
 type FileLoader struct {
 	urlFilePath    string // 短URL文件路径
 	offsetFilePath string // 偏移量文件路径
 	mu             sync.Mutex
+
+	codeLength int         // 每个短URL的字节数
+	useMmap    bool        // 是否使用内存映射读取
+	mapped     []byte      // 短URL文件的映射区域
+	mappedInfo os.FileInfo // 映射时的文件信息，用于发现文件被替换
+	name       string      // 指标中的号池名称
 }
 
 // NewFileLoader 创建文件加载器
@@ -37,80 +84,94 @@ func NewFileLoader(urlFile, offsetFile string) *FileLoader {
 	return &FileLoader{
 		urlFilePath:    urlFile,
 		offsetFilePath: offsetFile,
+		codeLength:     DefaultCodeLength,
 	}
 }
 
-// LoadBatch 加载一批短URL（带文件锁互斥）
-func (f *FileLoader) LoadBatch(count int) ([]string, error) {
+// SetCodeLength 设置短URL长度，需在首次加载前调用
+func (f *FileLoader) SetCodeLength(n int) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	f.codeLength = n
+}
 
-	// 1. 写打开偏移量文件（获取独占锁）
-	offsetFile, err := os.OpenFile(f.offsetFilePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open offset file: %w", err)
-	}
-	defer offsetFile.Close()
-
-	// 2. 对偏移量文件加独占锁
-	err = syscall.Flock(int(offsetFile.Fd()), syscall.LOCK_EX)
-	if err != nil {
-		return nil, fmt.Errorf("failed to lock offset file: %w", err)
-	}
-	defer syscall.Flock(int(offsetFile.Fd()), syscall.LOCK_UN)
+// CodeLength 返回短URL长度
+func (f *FileLoader) CodeLength() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.codeLength
+}
 
-	// 3. 读取当前偏移量
-	offset, err := readOffset(offsetFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read offset: %w", err)
-	}
+// LoadBatch 加载一批短URL（带文件锁互斥）
+func (f *FileLoader) LoadBatch(count int) ([]string, error) {
+	return f.LoadBatchContext(context.Background(), count)
+}
 
-	// 4. 读打开短URL文件
-	urlFile, err := os.Open(f.urlFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open url file: %w", err)
-	}
-	defer urlFile.Close()
+// LoadBatchContext 加载一批短URL，span中的offset.locked事件区分等待文件锁和读取的耗时
+func (f *FileLoader) LoadBatchContext(ctx context.Context, count int) (urls []string, err error) {
+	_, span := tracer.Start(ctx, "FileLoader.LoadBatch", trace.WithAttributes(
+		attribute.Int("batch.requested", count),
+		attribute.Bool("mmap", f.useMmap),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("batch.loaded", len(urls)))
+		tracing.End(span, err)
+	}()
 
-	// 5. 从偏移量位置读取数据
-	urls, bytesRead, err := readURLsFromFile(urlFile, offset, count)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read urls: %w", err)
-	}
-
-	// 6. 更新偏移量
-	newOffset := offset + int64(bytesRead)
-	err = writeOffset(offsetFile, newOffset)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	span.SetAttributes(attribute.String("pool", f.poolName()))
+
+	start := time.Now()
+	var next int64
+	err = UpdateOffset(f.offsetFilePath, func(offset int64) (int64, error) {
+		span.AddEvent("offset.locked", trace.WithAttributes(
+			attribute.Int64("offset", offset),
+			attribute.Float64("lock_wait_ms", float64(time.Since(start).Microseconds())/1000),
+		))
+
+		// 从偏移量位置读取数据
+		var bytesRead int
+		var err error
+		if f.useMmap {
+			urls, bytesRead, err = f.readURLsFromMmap(offset, count)
+		} else {
+			urls, bytesRead, err = f.readURLs(offset, count, f.codeLength)
+		}
+		if err != nil {
+			return offset, fmt.Errorf("failed to read urls: %w", err)
+		}
+		next = offset + int64(bytesRead)
+		return next, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to write offset: %w", err)
+		return nil, err
 	}
 
+	f.recordRemaining(next)
 	return urls, nil
 }
 
-// readOffset 读取偏移量
-func readOffset(file *os.File) (int64, error) {
-	file.Seek(0, 0)
-	var offset int64
-	_, err := fmt.Fscanf(file, "%d", &offset)
+// readURLs 打开短URL文件并从偏移量位置读取
+func (f *FileLoader) readURLs(offset int64, count, codeLength int) ([]string, int, error) {
+	urlFile, err := os.Open(f.urlFilePath)
 	if err != nil {
-		// 如果文件为空，返回0
-		return 0, nil
+		return nil, 0, fmt.Errorf("failed to open url file: %w", err)
 	}
-	return offset, nil
+	defer urlFile.Close()
+
+	return readURLsFromFile(urlFile, offset, count, codeLength)
 }
 
-// writeOffset 写入偏移量
-func writeOffset(file *os.File, offset int64) error {
-	file.Seek(0, 0)
-	file.Truncate(0)
-	_, err := fmt.Fprintf(file, "%d", offset)
-	return err
+// Close 释放加载器持有的资源
+func (f *FileLoader) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.unmap()
 }
 
 // readURLsFromFile 从文件读取短URL
-func readURLsFromFile(file *os.File, offset int64, count int) ([]string, int, error) {
-	const urlLength = 6
+func readURLsFromFile(file *os.File, offset int64, count, urlLength int) ([]string, int, error) {
 	bytesToRead := count * urlLength
 
 	buffer := make([]byte, bytesToRead)
@@ -118,6 +179,9 @@ func readURLsFromFile(file *os.File, offset int64, count int) ([]string, int, er
 
 	n, err := file.Read(buffer)
 	if err != nil && n == 0 {
+		if err == io.EOF {
+			return nil, 0, ErrPoolExhausted
+		}
 		return nil, 0, err
 	}
 
@@ -136,6 +200,9 @@ func NewLinkedURL(loader *FileLoader, threshold, batchSize int) *LinkedURL {
 		threshold: threshold,
 		batchSize: batchSize,
 		loader:    loader,
+		refilled:  make(chan struct{}),
+		errCh:     make(chan error, 16),
+		metrics:   newListMetrics(DefaultPoolName),
 	}
 }
 
@@ -144,17 +211,93 @@ func (l *LinkedURL) Init() error {
 	return l.loadMore()
 }
 
-// Acquire 获取一个短URL
+// Acquire 获取一个短URL，链表为空时立即返回 ErrNoURLs
 func (l *LinkedURL) Acquire() (string, error) {
 	l.mu.Lock()
 
 	if l.head == nil {
 		l.mu.Unlock()
-		return "", fmt.Errorf("no URLs available")
+		return "", ErrNoURLs
+	}
+
+	code, needLoad := l.popLocked()
+	l.mu.Unlock()
+
+	// 异步加载更多数据
+	if needLoad {
+		go l.refill(context.Background())
 	}
 
+	return code, nil
+}
+
+// AcquireContext 获取一个短URL，链表为空时等待补充加载完成，直到ctx结束
+func (l *LinkedURL) AcquireContext(ctx context.Context) (code string, err error) {
+	ctx, span := tracer.Start(ctx, "LinkedURL.Acquire")
+	waits := 0
+	defer func() {
+		span.SetAttributes(attribute.String("pool", l.poolName()), attribute.Int("waits", waits))
+		tracing.End(span, err)
+	}()
+
+	for {
+		l.mu.Lock()
+
+		if l.head != nil {
+			code, needLoad := l.popLocked()
+			l.mu.Unlock()
+			if needLoad {
+				// 加载在后台进行，不随请求取消，日志和span关联到触发加载的请求
+				go l.refill(context.WithoutCancel(ctx))
+			}
+			return code, nil
+		}
+		waits++
+		slog.DebugContext(ctx, "preload list empty, waiting for refill", "pool", l.nameLocked())
+
+		// 链表为空：确保有加载在进行，然后等待其结束
+		startLoad := !l.loading
+		if startLoad {
+			l.loading = true
+		}
+		wait := l.refilled
+		l.mu.Unlock()
+
+		if startLoad {
+			go l.refill(context.WithoutCancel(ctx))
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: %v", ErrNoURLs, ctx.Err())
+		case <-wait:
+		}
+
+		// 加载结束后仍为空：加载失败（包括号池耗尽）或没有加载到短URL时直接返回错误；
+		// 否则是这一批已被其他等待者取完，继续等待下一次加载直到ctx结束
+		l.mu.Lock()
+		empty := l.head == nil
+		err := l.lastErr
+		loaded := l.lastLoaded
+		l.mu.Unlock()
+
+		if empty {
+			if err != nil {
+				return "", err
+			}
+			if loaded == 0 {
+				return "", ErrNoURLs
+			}
+		}
+	}
+}
+
+// popLocked 弹出头节点，返回短URL以及是否需要触发加载（调用方需持有锁）
+func (l *LinkedURL) popLocked() (string, bool) {
 	// 获取头节点的短URL
 	code := l.head.Code
+	l.acquired++
+	l.metrics.acquired.Inc()
 
 	// 移动头指针
 	oldHead := l.head
@@ -166,17 +309,14 @@ func (l *LinkedURL) Acquire() (string, error) {
 	if l.head == nil {
 		l.tail = nil
 	}
+	l.metrics.depth.Set(float64(l.count))
 
 	// 检查是否需要触发加载
 	needLoad := l.count < l.threshold && !l.loading
-	l.mu.Unlock()
-
-	// 异步加载更多数据
 	if needLoad {
-		go l.loadMore()
+		l.loading = true
 	}
-
-	return code, nil
+	return code, needLoad
 }
 
 // loadMore 加载更多短URL到链表
@@ -192,19 +332,36 @@ func (l *LinkedURL) loadMore() error {
 	l.loading = true
 	l.mu.Unlock()
 
+	return l.refill(context.Background())
+}
+
+// refill 执行一次加载（调用方需已将loading置为true），结束时唤醒所有等待者
+func (l *LinkedURL) refill(ctx context.Context) error {
+	l.mu.Lock()
+	batchSize := l.batchSize
+	l.mu.Unlock()
+
 	// 从文件加载
-	urls, err := l.loader.LoadBatch(l.batchSize)
-	if err != nil {
-		l.mu.Lock()
-		l.loading = false
-		l.mu.Unlock()
-		return err
-	}
+	start := time.Now()
+	urls, err := l.loader.LoadBatchContext(ctx, batchSize)
+	elapsed := time.Since(start)
 
 	// 构建链表节点
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	l.metrics.refill.Observe(elapsed.Seconds())
+	if err != nil {
+		l.metrics.errors.Inc()
+		slog.ErrorContext(ctx, "preload refill failed", "pool", l.nameLocked(), "batch_size", batchSize, "error", err)
+	} else {
+		if l.refillLatency == 0 {
+			l.refillLatency = elapsed
+		} else {
+			l.refillLatency = (l.refillLatency*7 + elapsed*3) / 10
+		}
+	}
+
 	for _, code := range urls {
 		node := &URLNode{Code: code}
 
@@ -220,9 +377,39 @@ func (l *LinkedURL) loadMore() error {
 
 		l.count++
 	}
+	l.metrics.depth.Set(float64(l.count))
+	if err == nil {
+		slog.DebugContext(ctx, "preload refilled", "pool", l.nameLocked(),
+			"loaded", len(urls), "count", l.count, "duration", elapsed)
+	}
 
 	l.loading = false
-	return nil
+	l.lastErr = err
+	l.lastLoaded = len(urls)
+	close(l.refilled)
+	l.refilled = make(chan struct{})
+
+	if err != nil {
+		// 非阻塞通知，无人消费时丢弃
+		select {
+		case l.errCh <- err:
+		default:
+		}
+	}
+
+	return err
+}
+
+// Errors 返回加载错误通知通道
+func (l *LinkedURL) Errors() <-chan error {
+	return l.errCh
+}
+
+// LastError 返回最近一次加载的错误，成功时为nil
+func (l *LinkedURL) LastError() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastErr
 }
 
 // Count 返回当前链表中的节点数量
@@ -232,6 +419,39 @@ func (l *LinkedURL) Count() int {
 	return l.count
 }
 
+// tune 更新阈值、批量和获取速率，阈值提高后如低于阈值立即触发加载
+func (l *LinkedURL) tune(threshold, batchSize int, rate float64) {
+	l.mu.Lock()
+	l.threshold = threshold
+	l.batchSize = batchSize
+	l.acquireRate = rate
+
+	needLoad := l.count < l.threshold && !l.loading
+	if needLoad {
+		l.loading = true
+	}
+	l.mu.Unlock()
+
+	if needLoad {
+		go l.refill(context.Background())
+	}
+}
+
+// Stats 返回链表当前状态
+func (l *LinkedURL) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{
+		Count:         l.count,
+		Threshold:     l.threshold,
+		BatchSize:     l.batchSize,
+		Loading:       l.loading,
+		Acquired:      l.acquired,
+		AcquireRate:   l.acquireRate,
+		RefillLatency: l.refillLatency,
+	}
+}
+
 // IsLoading 返回是否正在加载
 func (l *LinkedURL) IsLoading() bool {
 	l.mu.Lock()
@@ -0,0 +1,349 @@
+package preload
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"fuxi/internal/generator"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxReported 检查号池时每类问题最多记录的条数
+const maxReported = 10
+
+// PoolFile 号池文件及其偏移量文件，用于离线检查和维护（poolctl）
+type PoolFile struct {
+	URLFile    string
+	OffsetFile string // 为空表示没有服务从该文件取号，整个文件都未消费
+	Length     int    // 短URL长度
+}
+
+// PoolStatus 号池的消费情况，数量均以短URL为单位
+type PoolStatus struct {
+	Total     int64
+	Consumed  int64
+	Remaining int64
+	Offset    int64 // 偏移量文件中的字节偏移
+}
+
+// Aligned 返回偏移量是否对齐到短URL长度
+func (s PoolStatus) Aligned(length int) bool {
+	return s.Offset%int64(length) == 0
+}
+
+// Status 读取号池总量和偏移量
+func (p PoolFile) Status() (PoolStatus, error) {
+	total, err := p.totalCodes()
+	if err != nil {
+		return PoolStatus{}, err
+	}
+	offset, err := ReadOffset(p.OffsetFile)
+	if err != nil {
+		return PoolStatus{}, err
+	}
+
+	consumed := offset / int64(p.Length)
+	return PoolStatus{
+		Total:     total,
+		Consumed:  consumed,
+		Remaining: max(total-consumed, 0),
+		Offset:    offset,
+	}, nil
+}
+
+// totalCodes 返回号池文件中完整短URL的数量
+func (p PoolFile) totalCodes() (int64, error) {
+	info, err := os.Stat(p.URLFile)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size() / int64(p.Length), nil
+}
+
+// VerifyReport 号池检查结果
+type VerifyReport struct {
+	Codes      int64    // 完整短URL数量
+	Duplicates int64    // 与前面的短URL重复的数量
+	Invalid    int64    // 含非法字符的数量
+	Problems   []string // 问题描述，重复和非法字符各最多记录maxReported条
+	problems   int64
+}
+
+// OK 返回是否没有发现问题
+func (r *VerifyReport) OK() bool {
+	return r.problems == 0
+}
+
+// Count 返回问题总数
+func (r *VerifyReport) Count() int64 {
+	return r.problems
+}
+
+// report 记录一个问题
+func (r *VerifyReport) report(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Verify 检查重复、字符集、长度对齐和偏移量是否越界
+func (p PoolFile) Verify() (*VerifyReport, error) {
+	file, err := os.Open(p.URLFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := ReadOffset(p.OffsetFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &VerifyReport{}
+	length := int64(p.Length)
+	if rem := info.Size() % length; rem != 0 {
+		r.report("对齐: 文件大小 %d 不是短URL长度 %d 的整数倍，末尾残余 %d 字节", info.Size(), length, rem)
+		r.problems++
+	}
+	if offset%length != 0 {
+		r.report("对齐: 偏移量 %d 不是短URL长度 %d 的整数倍", offset, length)
+		r.problems++
+	}
+	if offset > info.Size() {
+		r.report("偏移量: %d 超出文件大小 %d", offset, info.Size())
+		r.problems++
+	}
+
+	seen := make(map[string]int64, info.Size()/length)
+	reader := bufio.NewReaderSize(file, 1<<20)
+	buf := make([]byte, p.Length)
+
+	for index := int64(0); ; index++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			break
+		}
+		r.Codes++
+		code := string(buf)
+
+		if !generator.IsValidCode(code) {
+			if r.Invalid < maxReported {
+				r.report("字符集: 第 %d 个短URL %q 含非法字符", index, code)
+			}
+			r.Invalid++
+		}
+		if first, ok := seen[code]; ok {
+			if r.Duplicates < maxReported {
+				r.report("重复: 第 %d 个短URL %q 与第 %d 个重复", index, code, first)
+			}
+			r.Duplicates++
+			continue
+		}
+		seen[code] = index
+	}
+
+	r.problems += r.Duplicates + r.Invalid
+	return r, nil
+}
+
+// Rewind 回退偏移量，n>0时回退n个短URL，to>=0时回退到第to个（从0开始），返回修改前后的字节偏移
+//
+// 回退会重新发放已消费的短URL，调用方需确认这些短URL没有被使用。
+func (p PoolFile) Rewind(n, to int64) (from, target int64, err error) {
+	if n <= 0 && to < 0 {
+		return 0, 0, errors.New("one of -n or -to is required")
+	}
+
+	length := int64(p.Length)
+	err = UpdateOffset(p.OffsetFile, func(offset int64) (int64, error) {
+		from = offset
+		target = offset - n*length
+		if to >= 0 {
+			target = to * length
+		}
+		target = max(target, 0)
+		if target > offset {
+			return offset, fmt.Errorf("target %d is ahead of current offset %d, use skip instead", target/length, offset/length)
+		}
+		return target, nil
+	})
+	return from, target, err
+}
+
+// Skip 跳过n个短URL，最多跳到文件末尾，返回修改前后的字节偏移
+func (p PoolFile) Skip(n int64) (from, target int64, err error) {
+	if n <= 0 {
+		return 0, 0, errors.New("-n must be positive")
+	}
+	total, err := p.totalCodes()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length := int64(p.Length)
+	err = UpdateOffset(p.OffsetFile, func(offset int64) (int64, error) {
+		from = offset
+		target = min(offset+n*length, total*length)
+		return target, nil
+	})
+	return from, target, err
+}
+
+// MergeResult 合并号池的结果
+type MergeResult struct {
+	Read       int // 各输入未消费部分的短URL总数
+	Written    int // 写入新号池的数量
+	Duplicates int // 输入之间重复而跳过的数量
+	Issued     int // 与某个输入已消费部分相同（可能已经发放）而跳过的数量
+}
+
+// Merge 合并多个号池未消费的部分并去重，写入out，out的偏移量文件置为0
+//
+// 持有所有输入偏移量文件的锁期间读取输入、写入临时文件并重命名为out，
+// 成功后把各输入的偏移量推进到文件末尾，运行中的服务不会再从输入发放已并入新号池的短URL。
+// 任一输入已消费部分中的短URL可能已经发放，不写入新号池。
+// 没有偏移量文件的输入无法标记为已消费，需要force确认没有服务从该文件取号。
+func Merge(inputs []PoolFile, out, outOffset string, force bool) (*MergeResult, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("at least one input is required")
+	}
+	length := inputs[0].Length
+	offsetFiles := make([]string, len(inputs))
+	used := make(map[string]string)
+	claim := func(path, role string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if other, ok := used[abs]; ok {
+			return fmt.Errorf("%s is used as both %s and %s", path, other, role)
+		}
+		used[abs] = role
+		return nil
+	}
+	if err := claim(out, "output"); err != nil {
+		return nil, err
+	}
+	if err := claim(outOffset, "output offset"); err != nil {
+		return nil, err
+	}
+	for i, in := range inputs {
+		if in.Length != length {
+			return nil, fmt.Errorf("%s: code length %d differs from %d", in.URLFile, in.Length, length)
+		}
+		if in.OffsetFile == "" && !force {
+			return nil, fmt.Errorf("%s has no offset file and cannot be marked consumed, pass -force if no service issues codes from it", in.URLFile)
+		}
+		if err := claim(in.URLFile, "input"); err != nil {
+			return nil, err
+		}
+		if in.OffsetFile != "" {
+			if err := claim(in.OffsetFile, "input offset"); err != nil {
+				return nil, err
+			}
+		}
+		offsetFiles[i] = in.OffsetFile
+	}
+
+	result := &MergeResult{}
+	err := lockOffsets(offsetFiles, func(offsets []int64) ([]int64, error) {
+		issued := make(map[string]struct{})
+		var pending []string
+		ends := make([]int64, len(inputs))
+		for i, in := range inputs {
+			data, err := os.ReadFile(in.URLFile)
+			if err != nil {
+				return nil, err
+			}
+			// 偏移量未对齐时，偏移量所在的短URL也视为已消费
+			for pos := 0; pos+length <= len(data); pos += length {
+				code := string(data[pos : pos+length])
+				if int64(pos) < offsets[i] {
+					issued[code] = struct{}{}
+				} else {
+					pending = append(pending, code)
+				}
+			}
+			ends[i] = max(offsets[i], int64(len(data)))
+		}
+		result.Read = len(pending)
+
+		tmp, err := os.CreateTemp(filepath.Dir(out), filepath.Base(out)+".tmp*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		writer := bufio.NewWriterSize(tmp, 1<<20)
+		seen := make(map[string]struct{}, len(pending))
+		for _, code := range pending {
+			if _, ok := issued[code]; ok {
+				result.Issued++
+				continue
+			}
+			if _, ok := seen[code]; ok {
+				result.Duplicates++
+				continue
+			}
+			seen[code] = struct{}{}
+			writer.WriteString(code)
+			result.Written++
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to write output: %w", err)
+		}
+		if err := tmp.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to write output: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to write output: %w", err)
+		}
+		// 持有输出偏移量文件的锁完成替换和归零，正在使用输出号池的服务不会用旧偏移量读新文件；
+		// 输出偏移量文件已确认不是输入偏移量文件，不会重复加锁
+		err = UpdateOffset(outOffset, func(int64) (int64, error) {
+			if err := os.Rename(tmp.Name(), out); err != nil {
+				return 0, fmt.Errorf("failed to rename output: %w", err)
+			}
+			return 0, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ends, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lockOffsets 依次对各偏移量文件加独占锁（路径为空的跳过，偏移量视为0），
+// 全部持有后调用fn，fn成功时写回它返回的新偏移量，失败时偏移量都保持不变
+func lockOffsets(paths []string, fn func(offsets []int64) ([]int64, error)) error {
+	offsets := make([]int64, len(paths))
+	var next []int64
+
+	var lock func(i int) error
+	lock = func(i int) error {
+		if i == len(paths) {
+			var err error
+			next, err = fn(offsets)
+			return err
+		}
+		if paths[i] == "" {
+			return lock(i + 1)
+		}
+		return UpdateOffset(paths[i], func(offset int64) (int64, error) {
+			offsets[i] = offset
+			if err := lock(i + 1); err != nil {
+				return offset, err
+			}
+			return next[i], nil
+		})
+	}
+	return lock(0)
+}
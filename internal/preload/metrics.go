@@ -0,0 +1,93 @@
+package preload
+
+import (
+	"fuxi/internal/metrics"
+	"os"
+)
+
+// DefaultPoolName 未通过SetName命名时，指标中使用的号池名称
+const DefaultPoolName = "default"
+
+// Prometheus指标，按号池名称区分
+var (
+	preloadDepth = metrics.NewGaugeVec("fuxi_preload_depth",
+		"Short codes currently buffered in the preload list.", "pool")
+	preloadAcquired = metrics.NewCounterVec("fuxi_preload_acquired_total",
+		"Short codes handed out from the preload list.", "pool")
+	preloadRefillDuration = metrics.NewHistogramVec("fuxi_preload_refill_duration_seconds",
+		"Time spent loading one batch of short codes from the pool file.", metrics.DefBuckets, "pool")
+	preloadRefillErrors = metrics.NewCounterVec("fuxi_preload_refill_errors_total",
+		"Failed preload refills.", "pool")
+	poolRemaining = metrics.NewGaugeVec("fuxi_pool_remaining_codes",
+		"Unconsumed short codes left in the pool file after the last batch.", "pool")
+)
+
+// listMetrics 链表使用的子指标，创建时按号池名称绑定，避免热路径上查找标签
+type listMetrics struct {
+	depth    *metrics.Gauge
+	acquired *metrics.Counter
+	refill   *metrics.Histogram
+	errors   *metrics.Counter
+}
+
+func newListMetrics(pool string) listMetrics {
+	return listMetrics{
+		depth:    preloadDepth.With(pool),
+		acquired: preloadAcquired.With(pool),
+		refill:   preloadRefillDuration.With(pool),
+		errors:   preloadRefillErrors.With(pool),
+	}
+}
+
+// SetName 设置指标和链路追踪中的号池名称，需在Init之前调用
+func (l *LinkedURL) SetName(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.name = name
+	l.metrics = newListMetrics(name)
+	l.metrics.depth.Set(float64(l.count))
+}
+
+// poolName 返回号池名称
+func (l *LinkedURL) poolName() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nameLocked()
+}
+
+// nameLocked 返回号池名称（调用方需持有l.mu）
+func (l *LinkedURL) nameLocked() string {
+	if l.name == "" {
+		return DefaultPoolName
+	}
+	return l.name
+}
+
+// SetName 设置指标和链路追踪中的号池名称，需在首次加载前调用
+func (f *FileLoader) SetName(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.name = name
+}
+
+// poolName 返回号池名称（调用方需持有f.mu）
+func (f *FileLoader) poolName() string {
+	if f.name == "" {
+		return DefaultPoolName
+	}
+	return f.name
+}
+
+// recordRemaining 根据加载后的偏移量更新号池剩余数量（调用方需持有f.mu）
+func (f *FileLoader) recordRemaining(offset int64) {
+	info, err := os.Stat(f.urlFilePath)
+	if err != nil {
+		return
+	}
+	remaining := (info.Size() - offset) / int64(f.codeLength)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	poolRemaining.With(f.poolName()).Set(float64(remaining))
+}
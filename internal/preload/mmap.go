@@ -0,0 +1,116 @@
+package preload
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// NewMmapFileLoader 创建基于内存映射的文件加载器，适用于大号池
+//
+// 短URL直接从映射区域切分，避免每批Seek+Read和缓冲区分配；
+// 偏移量仍通过flock协调，多个进程可以共享同一个号池。
+func NewMmapFileLoader(urlFile, offsetFile string) *FileLoader {
+	return &FileLoader{
+		urlFilePath:    urlFile,
+		offsetFilePath: offsetFile,
+		codeLength:     DefaultCodeLength,
+		useMmap:        true,
+	}
+}
+
+// readURLsFromMmap 从映射区域读取短URL（调用方需持有f.mu和偏移量文件锁）
+func (f *FileLoader) readURLsFromMmap(offset int64, count int) ([]string, int, error) {
+	codeLength := f.codeLength
+	if err := f.ensureMapped(); err != nil {
+		return nil, 0, err
+	}
+
+	size := int64(len(f.mapped))
+	if offset >= size {
+		return nil, 0, ErrPoolExhausted
+	}
+
+	// 只取完整的短URL，末尾不足一个的残余字节不消费
+	end := offset + int64(count*codeLength)
+	if end > size {
+		end = offset + (size-offset)/int64(codeLength)*int64(codeLength)
+	}
+	if end == offset {
+		return nil, 0, ErrPoolExhausted
+	}
+
+	region := f.mapped[offset:end]
+	advise(region, syscall.MADV_WILLNEED)
+
+	// 整批只拷贝一次，各短URL共享这块内存
+	batch := string(region)
+	urls := make([]string, 0, len(batch)/codeLength)
+	for i := 0; i+codeLength <= len(batch); i += codeLength {
+		urls = append(urls, batch[i:i+codeLength])
+	}
+
+	// 已消费的整页不再需要
+	advise(f.mapped[pageFloor(offset):pageFloor(end)], syscall.MADV_DONTNEED)
+
+	return urls, len(batch), nil
+}
+
+// ensureMapped 映射短URL文件，文件大小变化（如追加合并）或被替换为新文件（如合并后重命名）时重新映射
+func (f *FileLoader) ensureMapped() error {
+	file, err := os.Open(f.urlFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open url file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat url file: %w", err)
+	}
+
+	if f.mapped != nil && int64(len(f.mapped)) == info.Size() && os.SameFile(f.mappedInfo, info) {
+		return nil
+	}
+	if err := f.unmap(); err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return ErrPoolExhausted
+	}
+
+	mapped, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("failed to mmap url file: %w", err)
+	}
+	advise(mapped, syscall.MADV_SEQUENTIAL)
+
+	f.mapped = mapped
+	f.mappedInfo = info
+	return nil
+}
+
+// unmap 解除映射（调用方需持有f.mu）
+func (f *FileLoader) unmap() error {
+	if f.mapped == nil {
+		return nil
+	}
+	err := syscall.Munmap(f.mapped)
+	f.mapped = nil
+	f.mappedInfo = nil
+	return err
+}
+
+// advise 设置映射区域的访问提示，失败不影响读取
+func advise(b []byte, advice int) {
+	if len(b) == 0 {
+		return
+	}
+	syscall.Madvise(b, advice)
+}
+
+// pageFloor 向下对齐到页边界
+func pageFloor(n int64) int64 {
+	pageSize := int64(os.Getpagesize())
+	return n / pageSize * pageSize
+}
@@ -0,0 +1,87 @@
+package preload
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// UpdateOffset 在偏移量文件的独占锁内读取偏移量，交给fn处理后写回新偏移量
+//
+// 所有消费号池的进程（API服务、poolctl）都通过这把flock协调，
+// fn返回错误时偏移量保持不变。
+func UpdateOffset(path string, fn func(offset int64) (int64, error)) error {
+	// 1. 写打开偏移量文件（获取独占锁）
+	offsetFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open offset file: %w", err)
+	}
+	defer offsetFile.Close()
+
+	// 2. 对偏移量文件加独占锁
+	err = syscall.Flock(int(offsetFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return fmt.Errorf("failed to lock offset file: %w", err)
+	}
+	defer syscall.Flock(int(offsetFile.Fd()), syscall.LOCK_UN)
+
+	// 3. 读取当前偏移量
+	offset, err := readOffset(offsetFile)
+	if err != nil {
+		return fmt.Errorf("failed to read offset: %w", err)
+	}
+
+	// 4. 由调用方计算新偏移量
+	newOffset, err := fn(offset)
+	if err != nil {
+		return err
+	}
+
+	// 5. 更新偏移量
+	err = writeOffset(offsetFile, newOffset)
+	if err != nil {
+		return fmt.Errorf("failed to write offset: %w", err)
+	}
+
+	return nil
+}
+
+// ReadOffset 在共享锁内读取偏移量，文件不存在时返回0
+func ReadOffset(path string) (int64, error) {
+	offsetFile, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open offset file: %w", err)
+	}
+	defer offsetFile.Close()
+
+	err = syscall.Flock(int(offsetFile.Fd()), syscall.LOCK_SH)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock offset file: %w", err)
+	}
+	defer syscall.Flock(int(offsetFile.Fd()), syscall.LOCK_UN)
+
+	return readOffset(offsetFile)
+}
+
+// readOffset 读取偏移量
+func readOffset(file *os.File) (int64, error) {
+	file.Seek(0, 0)
+	var offset int64
+	_, err := fmt.Fscanf(file, "%d", &offset)
+	if err != nil {
+		// 如果文件为空，返回0
+		return 0, nil
+	}
+	return offset, nil
+}
+
+// writeOffset 写入偏移量
+func writeOffset(file *os.File, offset int64) error {
+	file.Seek(0, 0)
+	file.Truncate(0)
+	_, err := fmt.Fprintf(file, "%d", offset)
+	return err
+}
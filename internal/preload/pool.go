@@ -0,0 +1,176 @@
+package preload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrUnknownPool 指定的号池不存在
+var ErrUnknownPool = errors.New("unknown pool")
+
+// errAPIKeysRemoved 配置文件仍包含api_keys时返回，号池改为签发API Key时绑定
+var errAPIKeysRemoved = errors.New("api_keys in pool config is no longer supported, bind a pool when issuing the API key instead")
+
+// PoolConfig 单个号池配置
+type PoolConfig struct {
+	Name       string `json:"name"`        // 号池名称
+	URLFile    string `json:"urls"`        // 短URL文件路径
+	OffsetFile string `json:"offset"`      // 偏移量文件路径
+	CodeLength int    `json:"code_length"` // 短URL长度，默认6
+	Threshold  int    `json:"threshold"`   // 触发加载的阈值，默认2000
+	BatchSize  int    `json:"batch_size"`  // 每次加载的数量，默认10000
+	Mmap       bool   `json:"mmap"`        // 是否使用内存映射读取
+}
+
+// Config 号池配置文件
+type Config struct {
+	Default string            `json:"default"`  // 默认号池，为空时取第一个
+	Pools   []PoolConfig      `json:"pools"`    // 号池列表
+	APIKeys map[string]string `json:"api_keys"` // 已废弃：按未认证的请求头路由，设置时拒绝启动
+}
+
+// LoadConfig 从JSON文件读取号池配置
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse pool config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Pool 一个命名号池：文件加载器加预加载链表
+type Pool struct {
+	Name   string
+	Loader *FileLoader
+	List   *LinkedURL
+}
+
+// CodeLength 返回号池的短URL长度
+func (p *Pool) CodeLength() int {
+	return p.Loader.CodeLength()
+}
+
+// Manager 管理多个命名号池并按请求路由
+type Manager struct {
+	pools map[string]*Pool
+	order []*Pool
+	def   *Pool
+}
+
+// NewManager 根据配置创建号池管理器
+func NewManager(cfg *Config) (*Manager, error) {
+	if len(cfg.Pools) == 0 {
+		return nil, fmt.Errorf("no pools configured")
+	}
+	if len(cfg.APIKeys) > 0 {
+		return nil, errAPIKeysRemoved
+	}
+
+	m := &Manager{
+		pools: make(map[string]*Pool),
+	}
+
+	for _, pc := range cfg.Pools {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("pool name is required")
+		}
+		if _, ok := m.pools[pc.Name]; ok {
+			return nil, fmt.Errorf("duplicate pool %q", pc.Name)
+		}
+
+		if pc.CodeLength == 0 {
+			pc.CodeLength = DefaultCodeLength
+		}
+		if pc.Threshold == 0 {
+			pc.Threshold = 2000
+		}
+		if pc.BatchSize == 0 {
+			pc.BatchSize = 10000
+		}
+
+		loader := NewFileLoader(pc.URLFile, pc.OffsetFile)
+		if pc.Mmap {
+			loader = NewMmapFileLoader(pc.URLFile, pc.OffsetFile)
+		}
+		loader.SetCodeLength(pc.CodeLength)
+		loader.SetName(pc.Name)
+
+		pool := &Pool{
+			Name:   pc.Name,
+			Loader: loader,
+			List:   NewLinkedURL(loader, pc.Threshold, pc.BatchSize),
+		}
+		pool.List.SetName(pc.Name)
+		m.pools[pc.Name] = pool
+		m.order = append(m.order, pool)
+	}
+
+	m.def = m.order[0]
+	if cfg.Default != "" {
+		pool, ok := m.pools[cfg.Default]
+		if !ok {
+			return nil, fmt.Errorf("default pool %q: %w", cfg.Default, ErrUnknownPool)
+		}
+		m.def = pool
+	}
+
+	return m, nil
+}
+
+// Init 初始化所有号池
+func (m *Manager) Init() error {
+	for _, pool := range m.order {
+		if err := pool.List.Init(); err != nil {
+			return fmt.Errorf("pool %q: %w", pool.Name, err)
+		}
+	}
+	return nil
+}
+
+// Route 按名称选择号池，名称为空时使用默认号池
+//
+// 调用方负责确认请求方有权使用该号池（见APIKey.Pool）。
+func (m *Manager) Route(name string) (*Pool, error) {
+	if name == "" {
+		return m.def, nil
+	}
+	pool, ok := m.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("pool %q: %w", name, ErrUnknownPool)
+	}
+	return pool, nil
+}
+
+// Get 按名称获取号池
+func (m *Manager) Get(name string) (*Pool, bool) {
+	pool, ok := m.pools[name]
+	return pool, ok
+}
+
+// Default 返回默认号池
+func (m *Manager) Default() *Pool {
+	return m.def
+}
+
+// Pools 按配置顺序返回所有号池
+func (m *Manager) Pools() []*Pool {
+	return m.order
+}
+
+// Close 释放所有号池的加载器
+func (m *Manager) Close() error {
+	var firstErr error
+	for _, pool := range m.order {
+		if err := pool.Loader.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
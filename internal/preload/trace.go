@@ -0,0 +1,6 @@
+package preload
+
+import "go.opentelemetry.io/otel"
+
+// tracer 预加载的链路追踪，使用全局TracerProvider，未安装时为空操作
+var tracer = otel.Tracer("fuxi/internal/preload")
@@ -0,0 +1,121 @@
+package preload
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// AdaptiveConfig 自适应预加载参数
+type AdaptiveConfig struct {
+	MinThreshold int           // 阈值下限
+	MaxThreshold int           // 阈值上限
+	MinBatch     int           // 批量下限
+	MaxBatch     int           // 批量上限
+	Headroom     float64       // 阈值需覆盖一次加载期间消耗量的倍数
+	Horizon      time.Duration // 每批短URL应覆盖的时长
+	Interval     time.Duration // 调整周期
+}
+
+// DefaultAdaptiveConfig 默认自适应参数
+func DefaultAdaptiveConfig() AdaptiveConfig {
+	return AdaptiveConfig{
+		MinThreshold: 200,
+		MaxThreshold: 50000,
+		MinBatch:     1000,
+		MaxBatch:     100000,
+		Headroom:     4,
+		Horizon:      30 * time.Second,
+		Interval:     time.Second,
+	}
+}
+
+// Tuner 根据获取速率和加载耗时动态调整阈值与批量
+type Tuner struct {
+	list         *LinkedURL
+	cfg          AdaptiveConfig
+	lastAcquired int64
+	lastTick     time.Time
+	rate         float64
+}
+
+// NewTuner 创建自适应调整器
+func NewTuner(list *LinkedURL, cfg AdaptiveConfig) *Tuner {
+	return &Tuner{
+		list:         list,
+		cfg:          cfg,
+		lastAcquired: list.Stats().Acquired,
+		lastTick:     time.Now(),
+	}
+}
+
+// Run 按周期调整，直到ctx结束
+func (t *Tuner) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.Adjust(now)
+		}
+	}
+}
+
+// Adjust 根据上次调整以来的获取量计算新的阈值和批量
+func (t *Tuner) Adjust(now time.Time) {
+	elapsed := now.Sub(t.lastTick).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	stats := t.list.Stats()
+	current := float64(stats.Acquired-t.lastAcquired) / elapsed
+	t.lastAcquired = stats.Acquired
+	t.lastTick = now
+
+	// 速率上升时立即跟随，下降时缓慢衰减，避免突发流量期间阈值被拉低
+	if current > t.rate {
+		t.rate = current
+	} else {
+		t.rate = t.rate*0.8 + current*0.2
+	}
+
+	// 加载耗时至少按10ms估算，首次加载前没有样本
+	latency := stats.RefillLatency
+	if latency < 10*time.Millisecond {
+		latency = 10 * time.Millisecond
+	}
+
+	threshold := clamp(int(math.Ceil(t.rate*latency.Seconds()*t.cfg.Headroom)), t.cfg.MinThreshold, t.cfg.MaxThreshold)
+	batchSize := clamp(int(math.Ceil(t.rate*t.cfg.Horizon.Seconds())), t.cfg.MinBatch, t.cfg.MaxBatch)
+
+	// 一批至少要能把链表补到阈值以上，否则会连续触发加载；
+	// 阈值不超过批量上限的一半，使批量不超过MaxBatch
+	if limit := t.cfg.MaxBatch / 2; threshold > limit {
+		threshold = limit
+	}
+	if batchSize < threshold*2 {
+		batchSize = threshold * 2
+	}
+
+	if threshold != stats.Threshold || batchSize != stats.BatchSize {
+		slog.Debug("preload tuned", "pool", t.list.poolName(),
+			"threshold", threshold, "batch_size", batchSize, "rate", t.rate)
+	}
+	t.list.tune(threshold, batchSize, t.rate)
+}
+
+// clamp 将v限制在[lo, hi]区间内
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"fmt"
+	"fuxi/internal/auth"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaStore 持久化的每日配额计数
+type QuotaStore interface {
+	ConsumeQuota(subject string, now time.Time, limit int) (used int, ok bool, err error)
+	RefundQuota(subject string, now time.Time) error
+}
+
+// KeyOrIP 已认证的请求按API Key区分，否则（包括引导管理员Key）按客户端IP区分
+func KeyOrIP(c *gin.Context) string {
+	if key := auth.Key(c); key != nil && key.ID != 0 {
+		return "key:" + strconv.FormatUint(uint64(key.ID), 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// Middleware 令牌桶限流，所有响应都带RateLimit-*头，被拒绝时返回429和Retry-After
+//
+// 响应头遵循IETF RateLimit header fields草案：Limit为桶容量，Remaining为剩余令牌，
+// Reset为令牌补满的秒数，Policy描述容量和补满窗口。
+func Middleware(l *Limiter, key func(*gin.Context) string) gin.HandlerFunc {
+	window := seconds(l.duration(float64(l.burst)))
+	policy := fmt.Sprintf("%d;w=%d", l.burst, window)
+
+	return func(c *gin.Context) {
+		d := l.Allow(key(c))
+		setHeaders(c, d.Limit, d.Remaining, d.Reset, policy)
+
+		if !d.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// QuotaMiddleware 每日创建配额，subject返回计数主体和当天上限（上限<=0时不限）
+//
+// 配额按UTC自然日重置。请求先预占一次配额，处理结果为4xx或5xx（参数错误、号池耗尽、保存失败等）
+// 时退还，只有成功创建才计入配额。配额比令牌桶更紧时RateLimit-*头报告配额。
+// 数据库不可用时放行并记录日志，避免配额存储故障导致无法创建短URL。
+func QuotaMiddleware(store QuotaStore, subject func(*gin.Context) (string, int)) gin.HandlerFunc {
+	rejected := rejectedTotal.With("daily_quota")
+
+	return func(c *gin.Context) {
+		name, limit := subject(c)
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		used, ok, err := store.ConsumeQuota(name, now, limit)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "quota check failed, allowing request", "subject", name, "error", err)
+			c.Next()
+			return
+		}
+		reset := untilNextDay(now)
+		policy := fmt.Sprintf("%d;w=86400", limit)
+		if ok {
+			remaining := limit - used
+			if current, err := strconv.Atoi(c.Writer.Header().Get("RateLimit-Remaining")); err != nil || remaining < current {
+				setHeaders(c, limit, remaining, reset, policy)
+			}
+			c.Next()
+			if c.Writer.Status() >= http.StatusBadRequest {
+				if err := store.RefundQuota(name, now); err != nil {
+					slog.WarnContext(c.Request.Context(), "failed to refund quota", "subject", name, "error", err)
+				}
+			}
+			return
+		}
+
+		rejected.Inc()
+		setHeaders(c, limit, max(limit-used, 0), reset, policy)
+		c.Header("Retry-After", strconv.Itoa(seconds(reset)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "daily quota exceeded",
+			"limit": limit,
+		})
+	}
+}
+
+// setHeaders 写入RateLimit-*响应头
+func setHeaders(c *gin.Context, limit, remaining int, reset time.Duration, policy string) {
+	c.Header("RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+	c.Header("RateLimit-Policy", policy)
+}
+
+// untilNextDay 返回距离下一个UTC零点的时间
+func untilNextDay(now time.Time) time.Duration {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return next.Sub(now)
+}
+
+// seconds 向上取整到秒，至少为1（Retry-After为0会让客户端立即重试）
+func seconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"fuxi/internal/metrics"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// shardCount 令牌桶分片数，减少重定向热路径上的锁竞争
+	shardCount = 32
+	// sweepInterval 清理空闲令牌桶的间隔
+	sweepInterval = time.Minute
+)
+
+// rejectedTotal 被限流拒绝的请求数
+var rejectedTotal = metrics.NewCounterVec("fuxi_ratelimit_rejected_total",
+	"Requests rejected by rate limiting or daily quotas.", "limiter")
+
+// Decision 一次限流判断的结果，用于生成RateLimit-*响应头
+type Decision struct {
+	Allowed    bool
+	Limit      int           // 桶容量（突发上限）
+	Remaining  int           // 本次请求之后剩余的令牌数
+	Reset      time.Duration // 令牌补满所需时间
+	RetryAfter time.Duration // 被拒绝时到下一个令牌可用的时间
+}
+
+// Limiter 按key（API Key或客户端IP）区分的令牌桶限流器
+//
+// 每个key一个桶，容量为burst，每秒补充rate个令牌。桶在首次请求时创建，
+// 空闲到补满后由定期清理删除，补满的桶与不存在的桶行为相同。
+type Limiter struct {
+	name   string
+	rate   float64
+	burst  int
+	shards [shardCount]limiterShard
+
+	rejected *metrics.Counter
+}
+
+type limiterShard struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter 创建限流器，name用于指标标签，rate为每秒补充的令牌数，burst为桶容量
+func NewLimiter(name string, rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &Limiter{
+		name:     name,
+		rate:     rate,
+		burst:    burst,
+		rejected: rejectedTotal.With(name),
+	}
+	for i := range l.shards {
+		l.shards[i].buckets = make(map[string]*bucket)
+	}
+	return l
+}
+
+// Name 返回限流器名称
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Allow 判断key的请求是否放行，放行时消耗一个令牌
+func (l *Limiter) Allow(key string) Decision {
+	return l.AllowAt(key, time.Now())
+}
+
+// AllowAt 按指定时间判断，便于测试
+func (l *Limiter) AllowAt(key string, now time.Time) Decision {
+	s := l.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		l.sweep(s, now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		s.buckets[key] = b
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	d := Decision{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.duration(1 - b.tokens)
+		l.rejected.Inc()
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = l.duration(float64(l.burst) - b.tokens)
+	return d
+}
+
+// duration 返回补充n个令牌所需的时间
+func (l *Limiter) duration(n float64) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(n / l.rate * float64(time.Second))
+}
+
+// sweep 删除已补满的桶（调用方需持有s.mu）
+func (l *Limiter) sweep(s *limiterShard, now time.Time) {
+	full := l.duration(float64(l.burst))
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= full {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Len 返回当前跟踪的桶数量
+func (l *Limiter) Len() int {
+	n := 0
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		n += len(s.buckets)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// shard 按FNV-1a哈希选择分片
+func (l *Limiter) shard(key string) *limiterShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return &l.shards[hash%shardCount]
+}
@@ -0,0 +1,154 @@
+package redirect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"fuxi/internal/storage"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Store 重定向使用的存储接口
+type Store interface {
+	GetTarget(ctx context.Context, code string) (*storage.Target, error)
+	GetMapping(code string) (*storage.URLMapping, error)
+	IncrementAccess(code string) error
+}
+
+// Handler 短URL重定向，/:code+ 或 ?preview=1 显示预览页
+type Handler struct {
+	store           Store
+	permanentMaxAge time.Duration  // 永久重定向的Cache-Control max-age
+	background      sync.WaitGroup // 响应后仍在运行的访问计数
+}
+
+// NewHandler 创建重定向处理器
+func NewHandler(store Store, permanentMaxAge time.Duration) *Handler {
+	return &Handler{store: store, permanentMaxAge: permanentMaxAge}
+}
+
+// Register 注册重定向路由，middleware在处理器之前执行（如限流）
+//
+// 307/308的短URL也接受其他方法；/:code/*rest 用于开启了路径转发的短URL，rest追加到目标URL的路径之后。
+func (h *Handler) Register(r gin.IRoutes, middleware ...gin.HandlerFunc) {
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	handlers := append(middleware[:len(middleware):len(middleware)], h.Handle)
+	r.Match(methods, "/:code", handlers...)
+	r.Match(methods, "/:code/*rest", handlers...)
+}
+
+// Wait 等待已返回响应的请求的访问计数完成，退出前调用
+func (h *Handler) Wait() {
+	h.background.Wait()
+}
+
+// Handle 短URL重定向
+func (h *Handler) Handle(c *gin.Context) {
+	code := c.Param("code")
+	preview := c.Query("preview") == "1"
+	if trimmed, ok := strings.CutSuffix(code, "+"); ok {
+		code, preview = trimmed, true
+	}
+
+	// 查询长URL
+	target, err := h.store.GetTarget(c.Request.Context(), code)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to look up short URL"})
+		return
+	}
+
+	// 未开启路径转发的短URL不接受追加的路径
+	rest := c.Param("rest")
+	if strings.Trim(rest, "/") != "" && !target.ForwardPath {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
+
+	// 已停用的短URL返回警告页，不计入访问量
+	if target.Disabled() {
+		renderWarning(c, code, target.DisabledReason)
+		return
+	}
+
+	// 只有307和308保留请求方法，其他类型的短URL只接受GET
+	if c.Request.Method != http.MethodGet {
+		if !target.PreservesMethod() {
+			c.Header("Allow", http.MethodGet)
+			c.JSON(405, gin.H{"error": "method not allowed"})
+			return
+		}
+		preview = false
+	}
+
+	// 按顺序匹配条件跳转规则，都不匹配时使用长URL
+	if ruleURL, ok := Select(target.Rules, c.Request, time.Now()); ok {
+		target.URL = ruleURL
+	}
+
+	// 合并访问时的路径、查询参数和UTM默认值；预览参数不转发
+	query := c.Request.URL.Query()
+	query.Del("preview")
+	dest, err := Destination(target, rest, query)
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to build destination URL"})
+		return
+	}
+
+	// 主动预览不计入访问量
+	if preview {
+		h.showPreview(c, code, dest, false)
+		return
+	}
+
+	// 增加访问计数（异步）
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		if err := h.store.IncrementAccess(code); err != nil {
+			slog.WarnContext(ctx, "failed to increment access count", "short_code", code, "error", err)
+		}
+	}()
+
+	// 设置了跳转前确认的短URL先显示预览页
+	if target.Interstitial && c.Request.Method == http.MethodGet {
+		h.showPreview(c, code, dest, true)
+		return
+	}
+
+	// 永久重定向允许缓存有限的时间，使修改和停用最终能生效；临时重定向不缓存，每次访问都计数。
+	// 设置了条件规则的短URL对不同访问者跳转到不同地址，也不缓存
+	if target.Permanent() && len(target.Rules) == 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.permanentMaxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "private, no-store")
+	}
+	c.Redirect(target.Status(), dest)
+}
+
+// showPreview 从数据库读取访问量和创建时间并返回预览页
+func (h *Handler) showPreview(c *gin.Context, code, dest string, interstitial bool) {
+	mapping, err := h.store.GetMapping(code)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(404, gin.H{"error": "short URL not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(500, gin.H{"error": "failed to look up short URL"})
+		return
+	}
+	renderPreview(c, mapping, dest, interstitial)
+}
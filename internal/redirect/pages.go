@@ -0,0 +1,74 @@
+package redirect
+
+import (
+	"fuxi/internal/storage"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewPage 预览页，显示目标地址、创建时间和访问量，由访问者决定是否继续
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link preview: {{.Code}}</title>
+</head>
+<body>
+<h1>{{if .Interstitial}}You are leaving for another site{{else}}Link preview{{end}}</h1>
+<p>The short link <code>{{.Code}}</code> redirects to:</p>
+<p><code>{{.URL}}</code></p>
+<dl>
+<dt>Created</dt><dd>{{.Created}}</dd>
+<dt>Clicks</dt><dd>{{.Clicks}}</dd>
+</dl>
+<p><a href="{{.URL}}" rel="nofollow noreferrer">Continue to the destination</a></p>
+</body>
+</html>
+`))
+
+// warningPage 停用短URL的警告页，不包含指向目标地址的链接
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link disabled</title>
+</head>
+<body>
+<h1>This link has been disabled</h1>
+<p>The short link <code>{{.Code}}</code> pointed to a destination that was flagged as malicious or deceptive, so it no longer redirects.</p>
+<p>Reason: {{.Reason}}</p>
+</body>
+</html>
+`))
+
+// renderPreview 返回预览页，dest为本次访问实际会跳转到的地址，interstitial为true时表示这是短URL设置的跳转前确认页
+func renderPreview(c *gin.Context, m *storage.URLMapping, dest string, interstitial bool) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	err := previewPage.Execute(c.Writer, gin.H{
+		"Code":         m.ShortCode,
+		"URL":          dest,
+		"Created":      m.CreatedAt.UTC().Format(time.RFC1123),
+		"Clicks":       m.AccessCount,
+		"Interstitial": interstitial,
+	})
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// renderWarning 返回停用短URL的警告页
+func renderWarning(c *gin.Context, code, reason string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusForbidden)
+	if err := warningPage.Execute(c.Writer, gin.H{"Code": code, "Reason": reason}); err != nil {
+		c.Error(err)
+	}
+}
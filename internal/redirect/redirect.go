@@ -0,0 +1,62 @@
+package redirect
+
+import (
+	"fmt"
+	"fuxi/internal/storage"
+	"net/url"
+	"strings"
+)
+
+// Destination 按短URL的转发设置构造最终跳转地址
+//
+// rest为短URL之后的路径（/:code/*rest中的rest），query为访问时的查询参数。
+// 查询参数的优先级：访问时的参数 > 目标URL自带的参数 > UTM默认值。
+// 没有需要改动的内容时原样返回目标URL，不重新编码其查询参数。
+func Destination(t *storage.Target, rest string, query url.Values) (string, error) {
+	rest = strings.Trim(rest, "/")
+	forwardPath := t.ForwardPath && rest != ""
+	forwardQuery := t.ForwardQuery && len(query) > 0
+	if !forwardPath && !forwardQuery && t.UTM == nil {
+		return t.URL, nil
+	}
+
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse destination: %w", err)
+	}
+	if forwardPath {
+		u = u.JoinPath(segments(rest)...)
+	}
+
+	params := u.Query()
+	changed := false
+	if forwardQuery {
+		for key, values := range query {
+			params[key] = values
+		}
+		changed = true
+	}
+	if t.UTM != nil {
+		for _, p := range t.UTM.Params() {
+			if p[1] != "" && !params.Has(p[0]) {
+				params.Set(p[0], p[1])
+				changed = true
+			}
+		}
+	}
+	if changed {
+		u.RawQuery = params.Encode()
+	}
+	return u.String(), nil
+}
+
+// segments 拆分追加的路径并逐段转义，丢弃空段、"." 和 ".."，使追加的路径不会越过目标URL的路径
+func segments(rest string) []string {
+	var elems []string
+	for _, seg := range strings.Split(rest, "/") {
+		if seg != "" && seg != "." && seg != ".." {
+			elems = append(elems, url.PathEscape(seg))
+		}
+	}
+	return elems
+}
@@ -0,0 +1,159 @@
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"fuxi/internal/storage"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxRules 每个短URL最多的规则数
+const MaxRules = 20
+
+// Devices 规则支持的设备类型，mobile包含ios和android
+var Devices = []string{"ios", "android", "mobile", "desktop"}
+
+// Select 按顺序返回第一条匹配请求的规则的目标URL，都不匹配时返回false，由调用方使用兜底地址
+func Select(rules []storage.Rule, r *http.Request, now time.Time) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+	ua := strings.ToLower(r.UserAgent())
+	lang := preferredLanguage(r.Header.Get("Accept-Language"))
+	query := r.URL.Query()
+
+	for _, rule := range rules {
+		if rule.Device != "" && !matchDevice(rule.Device, ua) {
+			continue
+		}
+		if rule.UserAgent != "" && !strings.Contains(ua, strings.ToLower(rule.UserAgent)) {
+			continue
+		}
+		if len(rule.Languages) > 0 && !slices.ContainsFunc(rule.Languages, func(l string) bool { return matchLanguage(l, lang) }) {
+			continue
+		}
+		if rule.Start != nil && now.Before(*rule.Start) {
+			continue
+		}
+		if rule.End != nil && !now.Before(*rule.End) {
+			continue
+		}
+		if !matchQuery(rule.Query, query) {
+			continue
+		}
+		return rule.URL, true
+	}
+	return "", false
+}
+
+// ValidateRules 检查规则的条件设置，不检查目标URL（由调用方校验和规范化）
+func ValidateRules(rules []storage.Rule) error {
+	if len(rules) > MaxRules {
+		return fmt.Errorf("at most %d rules are allowed", MaxRules)
+	}
+	for i, rule := range rules {
+		if err := validateRule(&rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateRule 检查单条规则
+func validateRule(rule *storage.Rule) error {
+	switch {
+	case rule.URL == "":
+		return errors.New("url is required")
+	case rule.Device == "" && rule.UserAgent == "" && len(rule.Languages) == 0 &&
+		rule.Start == nil && rule.End == nil && len(rule.Query) == 0:
+		// 没有条件的规则总是匹配，应直接作为兜底地址
+		return errors.New("at least one condition is required")
+	case rule.Device != "" && !slices.Contains(Devices, rule.Device):
+		return fmt.Errorf("device must be one of %s", strings.Join(Devices, ", "))
+	case len(rule.UserAgent) > 255:
+		return errors.New("user_agent must be at most 255 bytes")
+	case len(rule.Languages) > 10:
+		return errors.New("at most 10 languages are allowed")
+	case rule.Start != nil && rule.End != nil && !rule.Start.Before(*rule.End):
+		return errors.New("start must be before end")
+	case len(rule.Query) > 10:
+		return errors.New("at most 10 query parameters are allowed")
+	}
+	for _, l := range rule.Languages {
+		if l == "" || len(l) > 35 {
+			return fmt.Errorf("invalid language %q", l)
+		}
+	}
+	for name := range rule.Query {
+		if name == "" {
+			return errors.New("query parameter name must not be empty")
+		}
+	}
+	return nil
+}
+
+// matchDevice 根据User-Agent（已转为小写）判断设备类型
+func matchDevice(device, ua string) bool {
+	ios := strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod")
+	android := strings.Contains(ua, "android")
+	mobile := ios || android || strings.Contains(ua, "mobile")
+	switch device {
+	case "ios":
+		return ios
+	case "android":
+		return android
+	case "mobile":
+		return mobile
+	case "desktop":
+		return ua != "" && !mobile
+	}
+	return false
+}
+
+// matchLanguage 规则语言与首选语言相同，或是首选语言的主语言时匹配
+func matchLanguage(rule, lang string) bool {
+	if lang == "" {
+		return false
+	}
+	rule = strings.ToLower(rule)
+	return rule == lang || strings.HasPrefix(lang, rule+"-")
+}
+
+// matchQuery 检查所有规则参数，值为空时只要求参数存在
+func matchQuery(want map[string]string, query map[string][]string) bool {
+	for name, value := range want {
+		values, ok := query[name]
+		if !ok || (value != "" && !slices.Contains(values, value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// preferredLanguage 返回Accept-Language中权重最高的语言（小写），权重相同时取靠前的，忽略*
+func preferredLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,199 @@
+package screening
+
+import (
+	"bufio"
+	"fmt"
+	"fuxi/internal/urlcheck"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// hostsAliases hosts文件中常见的本机条目，不作为拦截域名
+var hostsAliases = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+}
+
+// Blocklist 从一个文件加载的拦截名单
+//
+// 支持两种格式，可以在同一文件中混用：
+//   - hosts文件：IP地址后跟一个或多个域名，如 "0.0.0.0 evil.example"
+//   - 普通列表：每行一个域名或URL
+//
+// 域名同时拦截其所有子域名；URL拦截该路径及其下级路径，不区分scheme。
+// "#" 之后为注释。
+type Blocklist struct {
+	Path    string
+	domains map[string]bool
+	urls    map[string][]string // urlKey的主机部分到路径前缀（含查询参数）的映射
+	nurls   int
+	invalid int // 无法解析而跳过的行数
+
+	modTime time.Time
+	size    int64
+}
+
+// LoadBlocklist 读取并解析拦截名单文件
+func LoadBlocklist(path string) (*Blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blocklist: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blocklist: %w", err)
+	}
+
+	b, err := ParseBlocklist(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocklist %s: %w", path, err)
+	}
+	b.Path = path
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+	return b, nil
+}
+
+// ParseBlocklist 解析hosts文件或普通列表格式的拦截名单
+func ParseBlocklist(r io.Reader) (*Blocklist, error) {
+	b := &Blocklist{domains: make(map[string]bool), urls: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i == 0 || i > 0 && (line[i-1] == ' ' || line[i-1] == '\t') {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		entries := fields
+		if len(fields) > 1 {
+			// hosts文件格式：第一列是IP地址
+			if net.ParseIP(fields[0]) == nil {
+				b.invalid++
+				continue
+			}
+			entries = fields[1:]
+		}
+		for _, entry := range entries {
+			if !b.add(entry) {
+				b.invalid++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// add 添加一个域名或URL条目，无法解析时返回false
+func (b *Blocklist) add(entry string) bool {
+	if strings.Contains(entry, "://") {
+		u, err := url.Parse(entry)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		key, ok := urlKey(u)
+		if ok {
+			host, path := splitKey(key)
+			b.urls[host] = append(b.urls[host], path)
+			b.nurls++
+		}
+		return ok
+	}
+
+	entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+	if hostsAliases[strings.ToLower(entry)] {
+		return true
+	}
+	host, err := urlcheck.NormalizeHost(entry)
+	if err != nil {
+		return false
+	}
+	b.domains[host] = true
+	return true
+}
+
+// Len 返回名单中的条目数
+func (b *Blocklist) Len() int {
+	return len(b.domains) + b.nurls
+}
+
+// Invalid 返回无法解析而跳过的条目数
+func (b *Blocklist) Invalid() int {
+	return b.invalid
+}
+
+// match 检查主机名（及其上级域名）和URL，返回命中的条目
+func (b *Blocklist) match(host, key string) (string, bool) {
+	for h := host; h != ""; {
+		if b.domains[h] {
+			return h, true
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 || net.ParseIP(host) != nil {
+			break
+		}
+		h = h[i+1:]
+	}
+
+	// URL条目按主机名索引，只比较同一主机下的路径前缀
+	keyHost, path := splitKey(key)
+	for _, prefix := range b.urls[keyHost] {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		// 只在路径边界处匹配：/phish 拦截 /phish/x 和 /phish?a，不拦截 /phishing
+		if len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || strings.ContainsRune("/?", rune(path[len(prefix)])) {
+			return keyHost + prefix, true
+		}
+	}
+	return "", false
+}
+
+// splitKey 把urlKey拆分为主机部分（含端口）和路径部分（含查询参数）
+func splitKey(key string) (host, path string) {
+	if i := strings.IndexAny(key, "/?"); i >= 0 {
+		return key[:i], key[i:]
+	}
+	return key, ""
+}
+
+// urlKey 返回用于匹配的URL形式：规范化的主机名、非默认端口、路径和查询参数，不含scheme和片段
+func urlKey(u *url.URL) (string, bool) {
+	host, err := urlcheck.NormalizeHost(u.Hostname())
+	if err != nil {
+		return "", false
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	key := host + u.EscapedPath()
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key, true
+}
@@ -0,0 +1,117 @@
+package screening
+
+import (
+	"context"
+	"fuxi/internal/metrics"
+	"fuxi/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// recheckBatch 后台检查时每次从数据库读取的短URL数量
+const recheckBatch = 500
+
+var disabledTotal = metrics.NewCounter("fuxi_screening_disabled_links_total",
+	"Existing links disabled by the background blocklist re-check.")
+
+// LinkStore 后台检查需要的存储操作
+type LinkStore interface {
+	ScanMappings(afterID uint, limit int) ([]storage.URLMapping, error)
+	DisableMapping(code, reason string) error
+}
+
+// Rechecker 用最新的拦截名单重新检查已有的短URL，命中的短URL被停用
+type Rechecker struct {
+	screener *Screener
+	store    LinkStore
+	interval time.Duration
+}
+
+// NewRechecker 创建后台检查，每隔interval以及名单内容变化时检查一遍全部短URL
+func NewRechecker(screener *Screener, store LinkStore, interval time.Duration) *Rechecker {
+	return &Rechecker{
+		screener: screener,
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Run 启动时检查一遍，之后定期和名单变化时再次检查，直到ctx取消
+func (r *Rechecker) Run(ctx context.Context) {
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	r.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			r.scan(ctx)
+		case <-r.screener.Reloaded():
+			r.scan(ctx)
+		}
+	}
+}
+
+// scan 执行一遍检查并记录结果
+func (r *Rechecker) scan(ctx context.Context) {
+	start := time.Now()
+	checked, disabled, err := r.Scan(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "blocklist re-check failed", "checked", checked, "disabled", disabled, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "blocklist re-check finished", "checked", checked, "disabled", disabled,
+		"duration_ms", time.Since(start).Milliseconds())
+}
+
+// Scan 按ID顺序检查全部未停用且未经管理员确认的短URL，返回检查数和停用数
+func (r *Rechecker) Scan(ctx context.Context) (checked, disabled int, err error) {
+	var afterID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return checked, disabled, err
+		}
+
+		mappings, err := r.store.ScanMappings(afterID, recheckBatch)
+		if err != nil {
+			return checked, disabled, err
+		}
+		if len(mappings) == 0 {
+			return checked, disabled, nil
+		}
+
+		for _, m := range mappings {
+			// 管理员已确认目标安全（名单误报），不再停用
+			if m.ReviewedAt != nil {
+				continue
+			}
+			checked++
+			// 长URL和任一规则的目标命中名单都停用整个短URL
+			var match Match
+			blocked := false
+			for _, u := range m.URLs() {
+				if match, blocked = r.screener.Check(u); blocked {
+					break
+				}
+			}
+			if !blocked {
+				continue
+			}
+			if err := r.store.DisableMapping(m.ShortCode, match.Reason()); err != nil {
+				slog.WarnContext(ctx, "failed to disable blocklisted link", "short_code", m.ShortCode, "error", err)
+				continue
+			}
+			disabled++
+			disabledTotal.Inc()
+			slog.WarnContext(ctx, "link disabled by blocklist", "short_code", m.ShortCode,
+				"long_url", m.LongURL, "rules", len(m.Rules), "list", match.List, "entry", match.Entry)
+		}
+		afterID = mappings[len(mappings)-1].ID
+	}
+}
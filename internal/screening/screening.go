@@ -0,0 +1,202 @@
+package screening
+
+import (
+	"errors"
+	"fmt"
+	"fuxi/internal/metrics"
+	"fuxi/internal/urlcheck"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	checksTotal = metrics.NewCounterVec("fuxi_screening_checks_total",
+		"Destination URLs checked against blocklists by result (clean or blocked).", "result")
+	checksClean   = checksTotal.With("clean")
+	checksBlocked = checksTotal.With("blocked")
+
+	entriesGauge = metrics.NewGaugeVec("fuxi_blocklist_entries",
+		"Domain and URL entries loaded from each blocklist file.", "list")
+)
+
+// Match 命中的拦截名单条目
+type Match struct {
+	List  string // 名单文件路径
+	Entry string // 命中的域名或URL
+}
+
+// Reason 返回写入短URL停用原因的描述，会显示在警告页上，不包含名单文件路径
+func (m Match) Reason() string {
+	return fmt.Sprintf("destination matches blocklist entry %s", m.Entry)
+}
+
+// Screener 用一组拦截名单检查目标URL，名单文件修改后自动重新加载
+type Screener struct {
+	paths    []string
+	interval time.Duration
+
+	mu    sync.RWMutex
+	lists []*Blocklist
+
+	version  atomic.Uint64 // 每次名单内容变化时加1
+	reloaded chan struct{} // 名单变化时通知后台检查，容量为1
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewScreener 加载名单文件，interval大于0时每隔interval检查文件是否修改
+//
+// 启动时任一文件无法读取都返回错误；之后重新加载失败时保留该文件上一次的内容。
+func NewScreener(paths []string, interval time.Duration) (*Screener, error) {
+	s := &Screener{
+		paths:    paths,
+		interval: interval,
+		lists:    make([]*Blocklist, len(paths)),
+		reloaded: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	// 首次加载不需要通知，后台检查启动时会先检查一遍
+	select {
+	case <-s.reloaded:
+	default:
+	}
+
+	if interval > 0 {
+		go s.run()
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// Reload 重新加载修改过的名单文件（按修改时间和大小判断），返回内容是否变化
+func (s *Screener) Reload() (bool, error) {
+	s.mu.RLock()
+	current := append([]*Blocklist(nil), s.lists...)
+	s.mu.RUnlock()
+
+	changed := false
+	var errs []error
+	for i, path := range s.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stat blocklist: %w", err))
+			continue
+		}
+		if old := current[i]; old != nil && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+			continue
+		}
+
+		list, err := LoadBlocklist(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		current[i] = list
+		changed = true
+		entriesGauge.With(path).Set(float64(list.Len()))
+		slog.Info("blocklist loaded", "path", path, "entries", list.Len(), "invalid", list.Invalid())
+	}
+
+	if changed {
+		s.mu.Lock()
+		s.lists = current
+		s.mu.Unlock()
+		s.version.Add(1)
+		select {
+		case s.reloaded <- struct{}{}:
+		default:
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// Check 检查目标URL，命中任一名单时返回命中的条目
+func (s *Screener) Check(rawURL string) (Match, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Match{}, false
+	}
+	host, err := urlcheck.NormalizeHost(u.Hostname())
+	if err != nil {
+		return Match{}, false
+	}
+	key, _ := urlKey(u)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, list := range s.lists {
+		if list == nil {
+			continue
+		}
+		if entry, ok := list.match(host, key); ok {
+			checksBlocked.Inc()
+			return Match{List: list.Path, Entry: entry}, true
+		}
+	}
+	checksClean.Inc()
+	return Match{}, false
+}
+
+// Len 返回所有名单的条目总数
+func (s *Screener) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, list := range s.lists {
+		if list != nil {
+			n += list.Len()
+		}
+	}
+	return n
+}
+
+// Version 返回名单内容的版本号，每次重新加载后变化
+func (s *Screener) Version() uint64 {
+	return s.version.Load()
+}
+
+// Reloaded 名单内容变化时收到通知（多次变化可能合并为一次），只应有一个接收者
+func (s *Screener) Reloaded() <-chan struct{} {
+	return s.reloaded
+}
+
+// Close 停止检查文件修改
+func (s *Screener) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return nil
+}
+
+// run 定期重新加载修改过的名单，直到Close
+func (s *Screener) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Reload(); err != nil {
+				slog.Warn("failed to reload blocklist", "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
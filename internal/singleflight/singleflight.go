@@ -0,0 +1,75 @@
+package singleflight
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// call 一次进行中的查询
+type call struct {
+	wg  sync.WaitGroup
+	val string
+	err error
+}
+
+// PanicError fn发生panic时，执行者和所有等待者都以该值重新panic
+type PanicError struct {
+	Value any    // recover得到的原始值
+	Stack []byte // 发生panic时执行者的调用栈
+}
+
+// Error 返回panic的值和调用栈
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Group 合并同一key的并发查询：同一时刻每个key只有一个查询在执行，
+// 其余调用方等待并共享其结果
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do 执行fn，同一key已有查询在执行时等待其结果；shared表示结果来自其他调用方的查询
+//
+// fn发生panic时不会让等待者永远阻塞：执行者和等待者都会以*PanicError重新panic。
+func (g *Group) Do(key string, fn func() (string, error)) (val string, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		if p, ok := c.err.(*PanicError); ok {
+			panic(p)
+		}
+		return c.val, c.err, true
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	if p, ok := c.err.(*PanicError); ok {
+		panic(p)
+	}
+	return c.val, c.err, false
+}
+
+// doCall 执行fn，无论是否panic都移除key并唤醒等待者
+func (g *Group) doCall(c *call, key string, fn func() (string, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+}
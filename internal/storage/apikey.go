@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix 明文API Key的前缀，便于在日志和代码仓库中识别泄漏的Key
+const APIKeyPrefix = "fx_"
+
+var (
+	// ErrInvalidAPIKey API Key不存在或已吊销
+	ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+	// ErrAPIKeyNotFound 按ID查找的API Key不存在
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// APIKey API Key记录，只保存SHA-256哈希，明文只在创建时返回一次
+type APIKey struct {
+	ID         uint   `gorm:"primarykey"`
+	Name       string `gorm:"size:100;not null"`
+	Prefix     string `gorm:"size:16;not null"` // 明文的前几位，用于在列表中识别Key
+	KeyHash    string `gorm:"uniqueIndex;size:64;not null"`
+	Admin      bool   `gorm:"not null;default:false"`      // 可以管理Key和所有短URL
+	DailyQuota int    `gorm:"not null;default:0"`          // 每日创建上限，0为使用全局默认值，负数为不限
+	Pool       string `gorm:"size:50;not null;default:''"` // 绑定的号池，为空时使用默认号池
+	CreatedAt  time.Time
+	RevokedAt  *time.Time `gorm:"index"`
+}
+
+// Revoked 返回Key是否已吊销
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// APIKeyStore API Key的签发、校验和吊销
+type APIKeyStore interface {
+	CreateAPIKey(name string, admin bool, dailyQuota int, pool string) (*APIKey, string, error)
+	AuthenticateAPIKey(raw string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id uint) error
+}
+
+// HashAPIKey 返回明文Key的SHA-256哈希（十六进制）
+//
+// Key本身是高熵随机串，不需要加盐或慢哈希。
+func HashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey 生成 "fx_" 加48位十六进制的随机Key
+func newAPIKey() (string, error) {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return APIKeyPrefix + hex.EncodeToString(b[:]), nil
+}
+
+// CreateAPIKey 签发新Key，返回记录和明文（明文不会被保存），pool为Key创建短URL时使用的号池
+func (s *LayeredStorage) CreateAPIKey(name string, admin bool, dailyQuota int, pool string) (*APIKey, string, error) {
+	raw, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		Name:       name,
+		Prefix:     raw[:len(APIKeyPrefix)+8],
+		KeyHash:    HashAPIKey(raw),
+		Admin:      admin,
+		DailyQuota: dailyQuota,
+		Pool:       pool,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return key, raw, nil
+}
+
+// AuthenticateAPIKey 校验明文Key，返回未吊销的Key记录
+func (s *LayeredStorage) AuthenticateAPIKey(raw string) (*APIKey, error) {
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key APIKey
+	start := time.Now()
+	err := s.db.Where("key_hash = ? AND revoked_at IS NULL", HashAPIKey(raw)).First(&key).Error
+	observeQuery("auth", start)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys 按创建顺序返回所有Key（包括已吊销的）
+func (s *LayeredStorage) ListAPIKeys() ([]APIKey, error) {
+	var keys []APIKey
+	if err := s.db.Order("id").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey 吊销Key，之后使用该Key的请求立即被拒绝；重复吊销不报错
+func (s *LayeredStorage) RevokeAPIKey(id uint) error {
+	result := s.db.Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		s.db.Model(&APIKey{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return ErrAPIKeyNotFound
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ARCCache 自适应替换缓存实现
+//
+// T1保存只访问过一次的条目，T2保存访问过多次的条目；B1/B2是对应的
+// 幽灵列表，只记录最近被淘汰的key。幽灵命中时调整T1的目标大小p，
+// 在偏重近期和偏重频率之间自适应，扫描流量只会冲刷T1。
+type ARCCache struct {
+	shardSet
+}
+
+// 条目所在的列表
+const (
+	arcT1 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+type arcEntry struct {
+	key   string
+	value string
+	size  int64
+	where int
+	hits  int64
+}
+
+func (e *arcEntry) cost() int64 {
+	return e.size
+}
+
+// arcShard 单个ARC分片，p和各列表用量都以budget的计量单位表示
+type arcShard struct {
+	mu     sync.Mutex
+	budget budget
+	p      int64
+	data   map[string]*list.Element
+	lists  [4]*sizedList
+}
+
+// NewARCCache 创建ARC缓存，分片数根据容量自动选择
+func NewARCCache(capacity int) *ARCCache {
+	return newARCCache(budget{entries: capacity})
+}
+
+func newARCCache(b budget) *ARCCache {
+	c := &ARCCache{}
+	c.initShards(b, b.shards(), func(b budget) segment {
+		s := &arcShard{budget: b}
+		s.reset()
+		return s
+	})
+	return c
+}
+
+func (s *arcShard) reset() {
+	s.p = 0
+	s.data = make(map[string]*list.Element)
+	for i := range s.lists {
+		s.lists[i] = newSizedList()
+	}
+}
+
+// used 返回列表按计量单位的用量
+func (s *arcShard) used(where int) int64 {
+	return s.budget.measure(s.lists[where].Len(), s.lists[where].size)
+}
+
+func (s *arcShard) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.data[key]
+	if !ok {
+		return "", false
+	}
+
+	entry := elem.Value.(*arcEntry)
+	if entry.where != arcT1 && entry.where != arcT2 {
+		// 幽灵条目没有值
+		return "", false
+	}
+
+	s.move(elem, arcT2, entry.value, entry.size)
+	entry.hits++
+	return entry.value, true
+}
+
+func (s *arcShard) put(key, value string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := entrySize(key, value)
+	cost := s.budget.cost(size)
+	c := s.budget.limit()
+	if cost > c {
+		// 单个条目超过分片上限，不缓存；已缓存的旧值也要删除，否则会继续返回更新前的值
+		if elem, ok := s.data[key]; ok {
+			where := elem.Value.(*arcEntry).where
+			s.lists[where].remove(elem)
+			delete(s.data, key)
+			if where == arcT1 || where == arcT2 {
+				return false, 1
+			}
+		}
+		return false, 0
+	}
+
+	if elem, ok := s.data[key]; ok {
+		entry := elem.Value.(*arcEntry)
+		switch entry.where {
+		case arcT1, arcT2:
+			s.move(elem, arcT2, value, size)
+			return false, s.replace(false, 0)
+
+		case arcB1:
+			// 最近淘汰的单次访问条目再次出现：增大T1目标
+			delta := cost
+			if b1, b2 := s.used(arcB1), s.used(arcB2); b1 < b2 {
+				delta = cost * (b2 / b1)
+			}
+			s.p = minInt64(c, s.p+delta)
+			evicted := s.replace(false, cost)
+			s.move(elem, arcT2, value, size)
+			return true, evicted
+
+		case arcB2:
+			// 最近淘汰的多次访问条目再次出现：减小T1目标
+			delta := cost
+			if b1, b2 := s.used(arcB1), s.used(arcB2); b2 < b1 {
+				delta = cost * (b1 / b2)
+			}
+			s.p = maxInt64(0, s.p-delta)
+			evicted := s.replace(true, cost)
+			s.move(elem, arcT2, value, size)
+			return true, evicted
+		}
+	}
+
+	// 全新条目：先修剪幽灵列表，保证 T1+B1 <= c 且总量 <= 2c
+	for s.used(arcT1)+s.used(arcB1)+cost > c && s.lists[arcB1].Len() > 0 {
+		s.dropBack(arcB1)
+	}
+	for s.used(arcT1)+s.used(arcT2)+s.used(arcB1)+s.used(arcB2)+cost > 2*c && s.lists[arcB2].Len() > 0 {
+		s.dropBack(arcB2)
+	}
+	evicted := s.replace(false, cost)
+
+	entry := &arcEntry{key: key, value: value, size: size, where: arcT1}
+	s.data[key] = s.lists[arcT1].pushFront(entry)
+	return true, evicted
+}
+
+// replace 为incoming腾出空间：将T1或T2的尾部淘汰到对应的幽灵列表
+func (s *arcShard) replace(hitB2 bool, incoming int64) int {
+	evicted := 0
+	for s.used(arcT1)+s.used(arcT2)+incoming > s.budget.limit() {
+		t1, t2 := s.used(arcT1), s.lists[arcT2].Len()
+
+		var elem *list.Element
+		var ghost int
+		if t1 > 0 && (t1 > s.p || (hitB2 && t1 == s.p) || t2 == 0) {
+			elem, ghost = s.lists[arcT1].Back(), arcB1
+		} else if t2 > 0 {
+			elem, ghost = s.lists[arcT2].Back(), arcB2
+		} else {
+			break
+		}
+
+		// 幽灵条目只保留key
+		entry := elem.Value.(*arcEntry)
+		entry.hits = 0
+		s.move(elem, ghost, "", entrySize(entry.key, ""))
+		evicted++
+	}
+	return evicted
+}
+
+// move 将条目移动到目标列表头部并更新值
+func (s *arcShard) move(elem *list.Element, where int, value string, size int64) {
+	entry := elem.Value.(*arcEntry)
+	s.lists[entry.where].remove(elem)
+	entry.where = where
+	entry.value = value
+	entry.size = size
+	s.data[entry.key] = s.lists[where].pushFront(entry)
+}
+
+// dropBack 彻底删除列表尾部条目
+func (s *arcShard) dropBack(where int) {
+	elem := s.lists[where].Back()
+	if elem == nil {
+		return
+	}
+	s.lists[where].remove(elem)
+	delete(s.data, elem.Value.(*arcEntry).key)
+}
+
+// remove 删除条目，不留下幽灵记录
+func (s *arcShard) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.data[key]; ok {
+		s.lists[elem.Value.(*arcEntry).where].remove(elem)
+		delete(s.data, key)
+	}
+}
+
+func (s *arcShard) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists[arcT1].Len() + s.lists[arcT2].Len()
+}
+
+func (s *arcShard) bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists[arcT1].size + s.lists[arcT2].size
+}
+
+func (s *arcShard) hottest(n int) []CacheItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []CacheItem
+	for _, where := range []int{arcT2, arcT1} {
+		for elem := s.lists[where].Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*arcEntry)
+			if entry.hits > 0 {
+				items = append(items, CacheItem{Key: entry.key, Value: entry.value, Hits: entry.hits})
+				entry.hits /= 2
+			}
+		}
+	}
+	return topItems(items, n)
+}
+
+func (s *arcShard) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 缓存淘汰策略
+const (
+	PolicyLRU     = "lru"     // 最近最少使用
+	PolicyTinyLFU = "tinylfu" // W-TinyLFU：窗口LRU + 频率准入的分段LRU
+	PolicyARC     = "arc"     // 自适应替换缓存
+)
+
+const (
+	// DefaultShards 默认分片数量上限
+	DefaultShards = 64
+	// minShardCapacity 每个分片的最小容量，容量较小时减少分片以保持淘汰精度
+	minShardCapacity = 64
+	// entryOverhead 每个条目除key和value外的估算开销：链表节点、条目结构体、map槽位和字符串头
+	entryOverhead = 128
+	// avgEntryBytes 按字节预算时用于估算条目数（选择分片数）的平均条目大小
+	avgEntryBytes = 256
+)
+
+// Cache 进程内缓存接口，不同淘汰策略实现同一接口
+type Cache interface {
+	Get(key string) (string, bool)
+	Put(key, value string)
+	Remove(key string)
+	HitRate() float64
+	HitRateOver(window time.Duration) float64
+	Size() int
+	Stats() CacheStats
+	Clear()
+
+	// Hottest 返回命中次数最多的n个条目，并将所有条目的命中计数减半，
+	// 使下一次调用的排序反映近期访问
+	Hottest(n int) []CacheItem
+}
+
+// CacheItem 缓存条目及其近期命中次数
+type CacheItem struct {
+	Key   string
+	Value string
+	Hits  int64
+}
+
+// CacheStats 缓存统计信息，计数从创建起累计，Clear不重置
+type CacheStats struct {
+	Hits       int64 // 命中次数
+	Misses     int64 // 未命中次数
+	Insertions int64 // 新写入的条目数（不含对已有条目的更新）
+	Evictions  int64 // 因容量淘汰的条目数
+	Size       int   // 当前条目数
+	Bytes      int64 // 当前估算占用字节数
+
+	HitRate1m  float64 // 最近1分钟命中率
+	HitRate5m  float64 // 最近5分钟命中率
+	HitRate15m float64 // 最近15分钟命中率
+}
+
+// NewCache 按策略名称创建缓存，maxBytes>0时按字节预算淘汰，忽略capacity
+func NewCache(policy string, capacity int, maxBytes int64) (Cache, error) {
+	b := budget{entries: capacity, bytes: maxBytes}
+
+	switch policy {
+	case "", PolicyLRU:
+		return newLRUCache(b, b.shards()), nil
+	case PolicyTinyLFU:
+		return newTinyLFUCache(b), nil
+	case PolicyARC:
+		return newARCCache(b), nil
+	default:
+		return nil, fmt.Errorf("unknown cache policy %q", policy)
+	}
+}
+
+// entrySize 估算一个条目占用的字节数
+func entrySize(key, value string) int64 {
+	return int64(len(key) + len(value) + entryOverhead)
+}
+
+// budget 缓存容量限制：bytes>0时按字节数，否则按条目数
+type budget struct {
+	entries int
+	bytes   int64
+}
+
+// limit 返回以计量单位（条目或字节）表示的上限
+func (b budget) limit() int64 {
+	if b.bytes > 0 {
+		return b.bytes
+	}
+	return int64(b.entries)
+}
+
+// measure 按当前计量单位计算条目数和字节数对应的用量
+func (b budget) measure(entries int, bytes int64) int64 {
+	if b.bytes > 0 {
+		return bytes
+	}
+	return int64(entries)
+}
+
+// cost 单个条目按当前计量单位的用量
+func (b budget) cost(size int64) int64 {
+	if b.bytes > 0 {
+		return size
+	}
+	return 1
+}
+
+// scale 按比例缩小上限，至少为1
+func (b budget) scale(num, den int64) budget {
+	if b.bytes > 0 {
+		b.bytes = maxInt64(b.bytes*num/den, 1)
+	} else {
+		b.entries = int(maxInt64(int64(b.entries)*num/den, 1))
+	}
+	return b
+}
+
+// shards 根据容量选择分片数：每个分片至少minShardCapacity个条目
+func (b budget) shards() int {
+	capacity := b.entries
+	if b.bytes > 0 {
+		capacity = int(b.bytes / avgEntryBytes)
+	}
+
+	shards := 1
+	for shards*2 <= DefaultShards && capacity/(shards*2) >= minShardCapacity {
+		shards *= 2
+	}
+	return shards
+}
+
+// split 将上限平均分配到n个分片，第i个分片分得余数的一份
+func (b budget) split(i, n int) budget {
+	if b.bytes > 0 {
+		part := b.bytes / int64(n)
+		if int64(i) < b.bytes%int64(n) {
+			part++
+		}
+		return budget{bytes: maxInt64(part, 1)}
+	}
+
+	part := b.entries / n
+	if i < b.entries%n {
+		part++
+	}
+	if part < 1 {
+		part = 1
+	}
+	return budget{entries: part}
+}
+
+// sizedEntry 可计算占用字节数的链表条目
+type sizedEntry interface {
+	cost() int64
+}
+
+// sizedList 记录条目总字节数的链表
+type sizedList struct {
+	*list.List
+	size int64
+}
+
+func newSizedList() *sizedList {
+	return &sizedList{List: list.New()}
+}
+
+func (l *sizedList) pushFront(entry sizedEntry) *list.Element {
+	l.size += entry.cost()
+	return l.PushFront(entry)
+}
+
+func (l *sizedList) remove(elem *list.Element) {
+	l.size -= elem.Value.(sizedEntry).cost()
+	l.Remove(elem)
+}
+
+// segment 单个缓存分片，自带锁
+type segment interface {
+	get(key string) (string, bool)
+	put(key, value string) (inserted bool, evicted int)
+	remove(key string)
+	len() int
+	bytes() int64
+	clear()
+	hottest(n int) []CacheItem
+}
+
+// shardSet 按key哈希到多个分片，统计命中率、写入数和淘汰数
+type shardSet struct {
+	shards     []segment
+	mask       uint32
+	hits       atomic.Int64
+	misses     atomic.Int64
+	insertions atomic.Int64
+	evictions  atomic.Int64
+	window     *hitWindow
+}
+
+// initShards 将容量平均分配到n个分片（n向上取整为2的幂）
+func (s *shardSet) initShards(b budget, shards int, newSegment func(b budget) segment) {
+	n := 1
+	for n < shards {
+		n *= 2
+	}
+
+	s.shards = make([]segment, n)
+	s.mask = uint32(n - 1)
+	s.window = newHitWindow()
+	for i := range s.shards {
+		s.shards[i] = newSegment(b.split(i, n))
+	}
+}
+
+// shard 返回key所在的分片（FNV-1a哈希）
+func (s *shardSet) shard(key string) segment {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return s.shards[hash&s.mask]
+}
+
+// Get 获取缓存
+func (s *shardSet) Get(key string) (string, bool) {
+	value, ok := s.shard(key).get(key)
+	if ok {
+		s.hits.Add(1)
+		cacheHitsMetric.Inc()
+	} else {
+		s.misses.Add(1)
+		cacheMissesMetric.Inc()
+	}
+	s.window.record(ok)
+	return value, ok
+}
+
+// Put 写入缓存
+func (s *shardSet) Put(key, value string) {
+	inserted, evicted := s.shard(key).put(key, value)
+	if inserted {
+		s.insertions.Add(1)
+		cacheInsertionsMetric.Inc()
+	}
+	if evicted > 0 {
+		s.evictions.Add(int64(evicted))
+		cacheEvictionsMetric.Add(float64(evicted))
+	}
+}
+
+// Remove 删除缓存（短URL被修改或删除时调用）
+func (s *shardSet) Remove(key string) {
+	s.shard(key).remove(key)
+}
+
+// HitRate 获取创建以来的缓存命中率
+func (s *shardSet) HitRate() float64 {
+	hits := s.hits.Load()
+	total := hits + s.misses.Load()
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+// HitRateOver 获取最近window时长内的命中率，最长15分钟
+func (s *shardSet) HitRateOver(window time.Duration) float64 {
+	return s.window.rate(window)
+}
+
+// Size 获取当前缓存大小
+func (s *shardSet) Size() int {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.len()
+	}
+	return size
+}
+
+// Stats 返回缓存统计信息
+func (s *shardSet) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:       s.hits.Load(),
+		Misses:     s.misses.Load(),
+		Insertions: s.insertions.Load(),
+		Evictions:  s.evictions.Load(),
+		HitRate1m:  s.window.rate(time.Minute),
+		HitRate5m:  s.window.rate(5 * time.Minute),
+		HitRate15m: s.window.rate(15 * time.Minute),
+	}
+	for _, shard := range s.shards {
+		stats.Size += shard.len()
+		stats.Bytes += shard.bytes()
+	}
+	return stats
+}
+
+// Hottest 合并各分片的热点条目，返回命中次数最多的n个
+func (s *shardSet) Hottest(n int) []CacheItem {
+	if n <= 0 {
+		return nil
+	}
+	var items []CacheItem
+	for _, shard := range s.shards {
+		items = append(items, shard.hottest(n)...)
+	}
+	return topItems(items, n)
+}
+
+// topItems 按命中次数降序排列并截取前n个
+func topItems(items []CacheItem, n int) []CacheItem {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Hits > items[j].Hits
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// Shards 返回分片数量
+func (s *shardSet) Shards() int {
+	return len(s.shards)
+}
+
+// Clear 清空缓存条目，统计计数继续累计
+func (s *shardSet) Clear() {
+	for _, shard := range s.shards {
+		shard.clear()
+	}
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
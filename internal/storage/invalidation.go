@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// InvalidationOp 短URL变更类型
+type InvalidationOp string
+
+const (
+	OpCreate InvalidationOp = "create" // 新建：其他实例更新布隆过滤器并清除负缓存
+	OpUpdate InvalidationOp = "update" // 修改目标URL：其他实例淘汰缓存
+	OpDelete InvalidationOp = "delete" // 删除：其他实例淘汰缓存
+	OpReset  InvalidationOp = "reset"  // 可能漏掉了消息：订阅方清空本地缓存，Code为空
+)
+
+// Invalidation 一条缓存失效消息
+type Invalidation struct {
+	Op   InvalidationOp
+	Code string
+}
+
+// InvalidationBus 在共享同一数据库的多个实例之间广播短URL变更
+//
+// 消息也会投递给发布者自己，订阅方的处理必须是幂等的。
+type InvalidationBus interface {
+	Publish(msg Invalidation) error
+	Subscribe(handler func(Invalidation))
+	Close() error
+}
+
+// MemoryBus 进程内广播，用于测试多个存储实例共享失效消息，Publish同步调用所有订阅者
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers []func(Invalidation)
+}
+
+// NewMemoryBus 创建进程内广播
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Publish 依次调用所有订阅者
+func (b *MemoryBus) Publish(msg Invalidation) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// Subscribe 注册订阅者
+func (b *MemoryBus) Subscribe(handler func(Invalidation)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Close 关闭广播
+func (b *MemoryBus) Close() error {
+	return nil
+}
+
+// genPrefix 广播文件首行的代数标记前缀，首行为"#gen 代数"
+const genPrefix = "#gen "
+
+// FileBus 基于追加写文件的广播，适用于同一台机器或共享目录上的多个实例
+//
+// 文件首行记录代数，之后每条消息是一行"操作 短URL"。发布方持有path.lock的flock写入，
+// 文件超过maxSize时写入代数加一的新文件并重命名替换，旧文件不再有写入。
+// 各实例保持当前文件打开，从启动时的文件末尾开始定期读取新增的行；发现文件被替换后
+// 先读完旧文件再切换到新文件，因此轮转不会丢失消息。代数不连续（两次读取之间轮转了
+// 不止一次）或文件被原地截断时无法确定漏掉了哪些消息，向订阅者分发OpReset。
+type FileBus struct {
+	path     string
+	interval time.Duration
+	maxSize  int64 // 超过该大小时轮转，<=0表示不轮转
+
+	writeMu sync.Mutex
+	lock    *os.File // path.lock，跨进程协调写入和轮转
+	file    *os.File // 追加写，轮转后重新打开
+	fileGen int64    // file的代数，文件被截断后在此基础上递增
+
+	mu       sync.Mutex
+	handlers []func(Invalidation)
+	reader   *os.File // 正在读取的文件，轮转后先读完再切换
+	gen      int64    // reader的代数
+	offset   int64
+	partial  []byte // 尚未读到换行符的不完整行
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFileBus 打开（不存在时创建）广播文件，每隔interval读取一次新消息，文件超过maxSize字节时轮转
+func NewFileBus(path string, interval time.Duration, maxSize int64) (*FileBus, error) {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open invalidation file: %w", err)
+	}
+	b := &FileBus{
+		path:     path,
+		interval: interval,
+		maxSize:  maxSize,
+		lock:     lock,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// 打开写入文件，没有代数标记的文件（空文件或旧版本写入的）替换为新一代
+	err = b.locked(func() error {
+		if err := b.reopen(); err != nil {
+			return err
+		}
+		gen, err := readGen(b.file)
+		if err != nil {
+			return b.rotate(1)
+		}
+		b.fileGen = gen
+		return nil
+	})
+	if err != nil {
+		b.closeFiles()
+		return nil, fmt.Errorf("failed to open invalidation file: %w", err)
+	}
+
+	// 只关心启动之后的变更
+	if err := b.openReader(); err != nil {
+		b.closeFiles()
+		return nil, fmt.Errorf("failed to open invalidation file: %w", err)
+	}
+	info, err := b.reader.Stat()
+	if err != nil {
+		b.closeFiles()
+		return nil, fmt.Errorf("failed to open invalidation file: %w", err)
+	}
+	b.offset = info.Size()
+
+	go b.run()
+	return b, nil
+}
+
+// locked 持有path.lock的独占锁调用fn
+func (b *FileBus) locked(fn func() error) error {
+	if err := syscall.Flock(int(b.lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock invalidation file: %w", err)
+	}
+	defer syscall.Flock(int(b.lock.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+// reopen 写入文件不存在或已被其他实例轮转替换时重新打开，调用方持有path.lock
+func (b *FileBus) reopen() error {
+	if b.file != nil {
+		current, err := os.Stat(b.path)
+		if err == nil {
+			opened, err := b.file.Stat()
+			if err != nil {
+				return err
+			}
+			if os.SameFile(current, opened) {
+				return nil
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		b.file.Close()
+		b.file = nil
+	}
+
+	file, err := os.OpenFile(b.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	b.file = file
+	return nil
+}
+
+// rotate 写入只含代数标记的新文件并重命名替换当前文件，调用方持有path.lock
+func (b *FileBus) rotate(gen int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(genPrefix + strconv.FormatInt(gen, 10) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), b.path); err != nil {
+		return err
+	}
+	b.fileGen = gen
+	return b.reopen()
+}
+
+// Publish 追加一行消息，文件超过maxSize时先轮转
+func (b *FileBus) Publish(msg Invalidation) error {
+	if strings.ContainsAny(msg.Code, " \n") {
+		return fmt.Errorf("invalid code %q", msg.Code)
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	err := b.locked(func() error {
+		if err := b.reopen(); err != nil {
+			return err
+		}
+		info, err := b.file.Stat()
+		if err != nil {
+			return err
+		}
+		gen, err := readGen(b.file)
+		if err != nil {
+			// 文件被外部截断或删除，换成新一代，读取方据此发现漏掉的消息
+			if err := b.rotate(b.fileGen + 1); err != nil {
+				return err
+			}
+		} else {
+			b.fileGen = gen
+			if b.maxSize > 0 && info.Size() >= b.maxSize {
+				if err := b.rotate(gen + 1); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = b.file.WriteString(string(msg.Op) + " " + msg.Code + "\n")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+// Subscribe 注册订阅者
+func (b *FileBus) Subscribe(handler func(Invalidation)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Close 停止读取并关闭文件
+func (b *FileBus) Close() error {
+	close(b.stop)
+	<-b.done
+	return b.closeFiles()
+}
+
+// closeFiles 关闭打开的文件，返回写入文件的关闭错误
+func (b *FileBus) closeFiles() error {
+	var err error
+	if b.file != nil {
+		err = b.file.Close()
+	}
+	if b.reader != nil {
+		b.reader.Close()
+	}
+	b.lock.Close()
+	return err
+}
+
+// run 定期读取新消息，直到Close
+func (b *FileBus) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Poll(); err != nil {
+				slog.Warn("failed to read invalidation file", "path", b.path, "error", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// openReader 打开path作为读取文件并读取代数，调用方持有b.mu
+func (b *FileBus) openReader() error {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	gen, err := readGen(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if b.reader != nil {
+		b.reader.Close()
+	}
+	b.reader = file
+	b.gen = gen
+	b.partial = nil
+	return nil
+}
+
+// readGen 读取文件首行的代数标记
+func readGen(file *os.File) (int64, error) {
+	line, err := bufio.NewReader(io.NewSectionReader(file, 0, 64)).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, genPrefix) {
+		return 0, errors.New("missing generation marker")
+	}
+	return strconv.ParseInt(strings.TrimSuffix(line[len(genPrefix):], "\n"), 10, 64)
+}
+
+// genHeaderLen 返回代数标记行的长度
+func genHeaderLen(gen int64) int64 {
+	return int64(len(genPrefix) + len(strconv.FormatInt(gen, 10)) + 1)
+}
+
+// Poll 立即读取并分发上次读取之后追加的消息
+func (b *FileBus) Poll() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// 先确认文件是否已被替换，再读完旧文件：替换之后旧文件不会再有写入
+	current, err := os.Stat(b.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	opened, err := b.reader.Stat()
+	if err != nil {
+		return err
+	}
+	replaced := current != nil && !os.SameFile(current, opened)
+
+	// 写入方从不原地改写文件，代数标记缺失或不符说明文件被外部截断，截断前未读的消息已经丢失
+	gen, err := readGen(b.reader)
+	lost := err != nil || gen != b.gen || opened.Size() < b.offset
+	if lost && !replaced {
+		// 下一次发布时写入方会换成新一代文件
+		return nil
+	}
+	if !lost {
+		if err := b.drain(); err != nil {
+			return err
+		}
+	}
+	if !replaced {
+		return nil
+	}
+
+	prev := b.gen
+	if err := b.openReader(); err != nil {
+		return err
+	}
+	b.offset = genHeaderLen(b.gen)
+	if lost {
+		b.reset("invalidation file truncated", "generation", b.gen)
+	} else if b.gen != prev+1 {
+		b.reset("invalidation file rotated more than once between polls", "from", prev, "to", b.gen)
+	}
+	return b.drain()
+}
+
+// reset 向订阅者分发OpReset，调用方持有b.mu
+func (b *FileBus) reset(reason string, args ...any) {
+	slog.Warn(reason+", clearing local caches", append([]any{"path", b.path}, args...)...)
+	for _, handler := range b.handlers {
+		handler(Invalidation{Op: OpReset})
+	}
+}
+
+// drain 读取并分发reader中offset之后的完整行，调用方持有b.mu
+func (b *FileBus) drain() error {
+	info, err := b.reader.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= b.offset {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(b.reader, b.offset, info.Size()-b.offset))
+	if err != nil {
+		return err
+	}
+	b.offset += int64(len(data))
+
+	data = append(b.partial, data...)
+	last := bytes.LastIndexByte(data, '\n')
+	if last < 0 {
+		b.partial = data
+		return nil
+	}
+	b.partial = append([]byte(nil), data[last+1:]...)
+
+	for _, line := range strings.Split(string(data[:last]), "\n") {
+		op, code, ok := strings.Cut(line, " ")
+		if !ok || code == "" {
+			continue
+		}
+		msg := Invalidation{Op: InvalidationOp(op), Code: code}
+		for _, handler := range b.handlers {
+			handler(msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUCache 分片LRU缓存实现
+//
+// 按短URL哈希到N个独立的LRU分片，每个分片一把锁，
+// 读请求只和落在同一分片的请求竞争。
+type LRUCache struct {
+	shardSet
+}
+
+// lruShard 单个LRU分片
+type lruShard struct {
+	budget  budget
+	size    int64
+	cache   map[string]*list.Element
+	lruList *list.List
+	mu      sync.Mutex
+}
+
+type cacheEntry struct {
+	key   string
+	value string
+	size  int64
+	hits  int64
+}
+
+// NewLRUCache 创建LRU缓存，分片数根据容量自动选择
+func NewLRUCache(capacity int) *LRUCache {
+	b := budget{entries: capacity}
+	return newLRUCache(b, b.shards())
+}
+
+// NewShardedLRUCache 创建指定分片数的LRU缓存，分片数向上取整为2的幂
+func NewShardedLRUCache(capacity, shards int) *LRUCache {
+	return newLRUCache(budget{entries: capacity}, shards)
+}
+
+func newLRUCache(b budget, shards int) *LRUCache {
+	c := &LRUCache{}
+	c.initShards(b, shards, func(b budget) segment {
+		return &lruShard{
+			budget:  b,
+			cache:   make(map[string]*list.Element),
+			lruList: list.New(),
+		}
+	})
+	return c
+}
+
+func (s *lruShard) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.cache[key]; ok {
+		s.lruList.MoveToFront(elem)
+		entry := elem.Value.(*cacheEntry)
+		entry.hits++
+		return entry.value, true
+	}
+	return "", false
+}
+
+func (s *lruShard) put(key, value string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := entrySize(key, value)
+	if s.budget.cost(size) > s.budget.limit() {
+		// 单个条目超过分片上限，不缓存；已缓存的旧值也要删除，否则会继续返回更新前的值
+		if elem, ok := s.cache[key]; ok {
+			s.removeElement(elem)
+			return false, 1
+		}
+		return false, 0
+	}
+
+	// 如果已存在，更新并移到前面
+	elem, exists := s.cache[key]
+	if exists {
+		s.lruList.MoveToFront(elem)
+		entry := elem.Value.(*cacheEntry)
+		s.size += size - entry.size
+		entry.value = value
+		entry.size = size
+	} else {
+		// 新增元素
+		entry := &cacheEntry{key: key, value: value, size: size}
+		s.cache[key] = s.lruList.PushFront(entry)
+		s.size += size
+	}
+
+	// 如果超过容量，删除最久未使用的
+	evicted := 0
+	for s.budget.measure(s.lruList.Len(), s.size) > s.budget.limit() {
+		oldest := s.lruList.Back()
+		if oldest == nil {
+			break
+		}
+		s.removeElement(oldest)
+		evicted++
+	}
+	return !exists, evicted
+}
+
+func (s *lruShard) removeElement(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	s.lruList.Remove(elem)
+	delete(s.cache, entry.key)
+	s.size -= entry.size
+}
+
+func (s *lruShard) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.cache[key]; ok {
+		s.removeElement(elem)
+	}
+}
+
+func (s *lruShard) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lruList.Len()
+}
+
+func (s *lruShard) bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *lruShard) hottest(n int) []CacheItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []CacheItem
+	for elem := s.lruList.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*cacheEntry)
+		if entry.hits > 0 {
+			items = append(items, CacheItem{Key: entry.key, Value: entry.value, Hits: entry.hits})
+			entry.hits /= 2
+		}
+	}
+	return topItems(items, n)
+}
+
+func (s *lruShard) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = make(map[string]*list.Element)
+	s.lruList = list.New()
+	s.size = 0
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"fuxi/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prometheus指标，同一进程内的所有存储实例共用
+var (
+	cacheRequests = metrics.NewCounterVec("fuxi_cache_requests_total",
+		"Local cache lookups by result (hit or miss).", "result")
+	cacheHitsMetric   = cacheRequests.With("hit")
+	cacheMissesMetric = cacheRequests.With("miss")
+
+	cacheInsertionsMetric = metrics.NewCounter("fuxi_cache_insertions_total",
+		"Entries newly inserted into the local cache.")
+	cacheEvictionsMetric = metrics.NewCounter("fuxi_cache_evictions_total",
+		"Entries evicted from the local cache to stay within capacity.")
+
+	l2Requests = metrics.NewCounterVec("fuxi_l2_requests_total",
+		"Second-tier cache lookups by result (hit, miss or error).", "result")
+
+	negativeHitsMetric = metrics.NewCounter("fuxi_negative_lookups_total",
+		"Lookups rejected by the negative cache or Bloom filter without querying the database.")
+
+	dbQueryDuration = metrics.NewHistogramVec("fuxi_db_query_duration_seconds",
+		"Database query latency by operation.", metrics.DefBuckets, "op")
+	dbGetDuration = dbQueryDuration.With("get")
+)
+
+const (
+	// windowBucket 滑动窗口每个桶覆盖的时长
+	windowBucket = 10 * time.Second
+	// windowBuckets 桶数量，覆盖最长的15分钟窗口
+	windowBuckets = int(15 * time.Minute / windowBucket)
+)
+
+// hitWindow 按10秒分桶的命中/未命中计数，用于计算最近1/5/15分钟的命中率
+//
+// 桶在首次写入时按时间编号重置，读取时只统计窗口内的桶。
+// 跨桶切换瞬间的少量计数可能落入旧桶，对分钟级命中率的影响可以忽略。
+type hitWindow struct {
+	mu      sync.Mutex
+	buckets [windowBuckets]hitBucket
+	now     func() time.Time
+}
+
+type hitBucket struct {
+	epoch  atomic.Int64 // 桶对应的时间编号（Unix时间/桶时长）
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func newHitWindow() *hitWindow {
+	return &hitWindow{now: time.Now}
+}
+
+// bucket 返回当前时间所在的桶，必要时重置
+func (w *hitWindow) bucket() *hitBucket {
+	epoch := w.now().UnixNano() / int64(windowBucket)
+	b := &w.buckets[epoch%int64(windowBuckets)]
+	if b.epoch.Load() != epoch {
+		w.mu.Lock()
+		if b.epoch.Load() != epoch {
+			b.hits.Store(0)
+			b.misses.Store(0)
+			b.epoch.Store(epoch)
+		}
+		w.mu.Unlock()
+	}
+	return b
+}
+
+func (w *hitWindow) record(hit bool) {
+	b := w.bucket()
+	if hit {
+		b.hits.Add(1)
+	} else {
+		b.misses.Add(1)
+	}
+}
+
+// rate 返回最近window时长内的命中率，没有请求时返回0
+func (w *hitWindow) rate(window time.Duration) float64 {
+	epoch := w.now().UnixNano() / int64(windowBucket)
+	n := int64(window / windowBucket)
+
+	var hits, misses int64
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if e := b.epoch.Load(); e > epoch-n && e <= epoch {
+			hits += b.hits.Load()
+			misses += b.misses.Load()
+		}
+	}
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// Latency 一类请求的次数和累计耗时
+type Latency struct {
+	Count int64
+	Total time.Duration
+}
+
+// Mean 返回平均耗时
+func (l Latency) Mean() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+// latencyStat 并发安全的耗时累计
+type latencyStat struct {
+	count atomic.Int64
+	total atomic.Int64
+}
+
+// since 记录从start到现在的耗时，返回该耗时
+func (l *latencyStat) since(start time.Time) time.Duration {
+	elapsed := time.Since(start)
+	l.count.Add(1)
+	l.total.Add(int64(elapsed))
+	return elapsed
+}
+
+func (l *latencyStat) load() Latency {
+	return Latency{Count: l.count.Load(), Total: time.Duration(l.total.Load())}
+}
+
+// observeQuery 记录一次数据库操作的耗时
+func observeQuery(op string, start time.Time) {
+	dbQueryDuration.With(op).Observe(time.Since(start).Seconds())
+}
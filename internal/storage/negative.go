@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// NegativeCache 短期记录"未找到"的短URL，避免扫描请求反复查询数据库
+type NegativeCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type negativeEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewNegativeCache 创建负缓存，超过容量时丢弃最早写入的记录
+func NewNegativeCache(ttl time.Duration, capacity int) *NegativeCache {
+	return &NegativeCache{
+		ttl:      ttl,
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Add 记录一个未找到的短URL
+func (c *NegativeCache) Add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*negativeEntry).expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&negativeEntry{key: key, expires: expires})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*negativeEntry).key)
+	}
+}
+
+// Contains 检查短URL是否在有效期内被记录为未找到
+func (c *NegativeCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(elem.Value.(*negativeEntry).expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+// Remove 删除记录（短URL被创建时调用）
+func (c *NegativeCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Clear 删除所有记录
+func (c *NegativeCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Len 返回记录数量
+func (c *NegativeCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
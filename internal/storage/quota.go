@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QuotaDayLayout 配额按UTC自然日计数的日期格式
+const QuotaDayLayout = "2006-01-02"
+
+// DailyQuota 每个主体（API Key或客户端IP）每天的短URL创建次数
+type DailyQuota struct {
+	Subject   string `gorm:"primaryKey;size:64"`
+	Day       string `gorm:"primaryKey;size:10"` // UTC日期，见QuotaDayLayout
+	Count     int    `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
+// TableName 固定表名（GORM的复数规则会把quota当作复数，生成daily_quota），ConsumeQuota的原生SQL依赖它
+func (DailyQuota) TableName() string {
+	return "daily_quotas"
+}
+
+// ConsumeQuota 将subject当天的创建次数加1并返回加1后的次数
+//
+// 已达到limit时不再增加，返回当前次数和ok=false。计数在数据库中原子更新，
+// 重启后保留，多个实例共享同一数据库时共用配额。
+func (s *LayeredStorage) ConsumeQuota(subject string, now time.Time, limit int) (used int, ok bool, err error) {
+	day := now.UTC().Format(QuotaDayLayout)
+
+	start := time.Now()
+	result := s.db.Exec(`INSERT INTO daily_quotas (subject, day, count, updated_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT(subject, day) DO UPDATE SET count = count + 1, updated_at = excluded.updated_at
+		WHERE daily_quotas.count < ?`, subject, day, now, limit)
+	observeQuery("quota", start)
+	if result.Error != nil {
+		return 0, false, fmt.Errorf("failed to update quota: %w", result.Error)
+	}
+
+	used, err = s.QuotaUsage(subject, now)
+	if err != nil {
+		return 0, false, err
+	}
+	return used, result.RowsAffected > 0, nil
+}
+
+// RefundQuota 将subject在now所在那天的创建次数减1，用于退还创建失败的请求预占的配额
+func (s *LayeredStorage) RefundQuota(subject string, now time.Time) error {
+	start := time.Now()
+	err := s.db.Model(&DailyQuota{}).
+		Where("subject = ? AND day = ? AND count > 0", subject, now.UTC().Format(QuotaDayLayout)).
+		Update("count", gorm.Expr("count - 1")).Error
+	observeQuery("quota", start)
+	if err != nil {
+		return fmt.Errorf("failed to refund quota: %w", err)
+	}
+	return nil
+}
+
+// QuotaUsage 返回subject当天已使用的创建次数
+func (s *LayeredStorage) QuotaUsage(subject string, now time.Time) (int, error) {
+	var used int
+	err := s.db.Model(&DailyQuota{}).
+		Where("subject = ? AND day = ?", subject, now.UTC().Format(QuotaDayLayout)).
+		Select("count").Scan(&used).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to read quota: %w", err)
+	}
+	return used, nil
+}
+
+// PruneQuotas 删除before之前各天的配额记录，返回删除的行数
+func (s *LayeredStorage) PruneQuotas(before time.Time) (int64, error) {
+	result := s.db.Where("day < ?", before.UTC().Format(QuotaDayLayout)).Delete(&DailyQuota{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune quotas: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// L2Cache 多个实例共享的二级缓存
+type L2Cache interface {
+	// Get 返回缓存值，不存在时ok为false；连接或协议错误通过err返回
+	Get(key string) (value string, ok bool, err error)
+	// Set 写入缓存，ttl<=0表示不过期
+	Set(key, value string, ttl time.Duration) error
+	// Add 只在key不存在时写入，返回是否写入
+	Add(key, value string, ttl time.Duration) (bool, error)
+	Delete(key string) error
+	Close() error
+}
+
+// RedisOptions Redis连接配置
+type RedisOptions struct {
+	Addr      string        // 服务器地址 host:port
+	Password  string        // AUTH密码，为空时不认证
+	DB        int           // SELECT的数据库编号
+	KeyPrefix string        // key前缀，多个服务共用一个Redis时区分命名空间
+	PoolSize  int           // 最大空闲连接数，默认16
+	Timeout   time.Duration // 建立连接和单次命令的超时，默认200ms
+}
+
+// RedisCache 基于RESP协议的二级缓存客户端
+//
+// 只实现GET/SET/DEL，连接按需建立并放回空闲池；命令失败的连接直接关闭，
+// 不放回池中，避免读到上一条命令残留的响应。
+type RedisCache struct {
+	opts RedisOptions
+	idle chan *redisConn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisError 服务器返回的错误响应
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// errNil 空值响应（key不存在）
+var errNil = errors.New("redis: nil")
+
+// NewRedisCache 创建Redis二级缓存客户端，并检查服务器是否可用
+func NewRedisCache(opts RedisOptions) (*RedisCache, error) {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 16
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 200 * time.Millisecond
+	}
+
+	c := &RedisCache{
+		opts: opts,
+		idle: make(chan *redisConn, opts.PoolSize),
+	}
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis %s: %w", opts.Addr, err)
+	}
+	return c, nil
+}
+
+// Get 读取缓存
+func (c *RedisCache) Get(key string) (string, bool, error) {
+	reply, err := c.do("GET", c.opts.KeyPrefix+key)
+	if err == errNil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+// Set 写入缓存，ttl按毫秒精度设置
+func (c *RedisCache) Set(key, value string, ttl time.Duration) error {
+	args := []string{"SET", c.opts.KeyPrefix + key, value}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := c.do(args...)
+	return err
+}
+
+// Add 只在key不存在时写入（SET NX），返回是否写入
+func (c *RedisCache) Add(key, value string, ttl time.Duration) (bool, error) {
+	args := []string{"SET", c.opts.KeyPrefix + key, value}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := c.do(append(args, "NX")...)
+	if err == errNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete 删除缓存
+func (c *RedisCache) Delete(key string) error {
+	_, err := c.do("DEL", c.opts.KeyPrefix+key)
+	return err
+}
+
+// Close 关闭所有空闲连接
+func (c *RedisCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.idle)
+	for rc := range c.idle {
+		rc.conn.Close()
+	}
+	return nil
+}
+
+// do 执行一条命令并返回响应
+func (c *RedisCache) do(args ...string) (interface{}, error) {
+	rc, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	rc.conn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	reply, err := rc.roundTrip(args)
+	if err != nil {
+		if _, ok := err.(redisError); !ok && err != errNil {
+			// 网络或协议错误，连接状态未知
+			rc.conn.Close()
+			return nil, err
+		}
+	}
+	c.put(rc)
+	return reply, err
+}
+
+// get 从空闲池取连接，没有时新建
+func (c *RedisCache) get() (*redisConn, error) {
+	select {
+	case rc, ok := <-c.idle:
+		if ok {
+			return rc, nil
+		}
+		return nil, errors.New("redis: client closed")
+	default:
+	}
+	return c.dial()
+}
+
+// put 归还连接，空闲池已满或客户端已关闭时关闭连接
+func (c *RedisCache) put(rc *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		rc.conn.Close()
+		return
+	}
+	select {
+	case c.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+// dial 建立连接并完成认证和选库
+func (c *RedisCache) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", c.opts.Addr, c.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+
+	conn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	if c.opts.Password != "" {
+		if _, err := rc.roundTrip([]string{"AUTH", c.opts.Password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := rc.roundTrip([]string{"SELECT", strconv.Itoa(c.opts.DB)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// roundTrip 以RESP数组发送命令并读取一个响应
+func (rc *redisConn) roundTrip(args []string) (interface{}, error) {
+	if err := WriteRESPCommand(rc.w, args); err != nil {
+		return nil, err
+	}
+	if err := rc.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	reply, err := ReadRESP(rc.r)
+	if err != nil {
+		return nil, err
+	}
+	switch v := reply.(type) {
+	case nil:
+		return nil, errNil
+	case redisError:
+		return nil, v
+	}
+	return reply, nil
+}
+
+// WriteRESPCommand 将命令编码为RESP批量字符串数组
+func WriteRESPCommand(w *bufio.Writer, args []string) error {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.WriteString(arg)
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRESP 读取一个RESP值
+//
+// 简单字符串和批量字符串返回string，整数返回int64，数组返回[]interface{}，
+// 空值返回nil，错误响应返回实现了error的值。
+func ReadRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = ReadRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// readLine 读取一行并去掉结尾的\r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,354 @@
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"fuxi/internal/storage"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 内存中的RESP协议服务器，用于在没有真实Redis时测试二级缓存。
+// 支持PING、AUTH、SELECT、GET、SET（EX/PX/NX/XX）、
+// DEL、EXISTS、PTTL、DBSIZE和FLUSHALL，过期在访问时惰性清理
+type Server struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	data     map[string]item
+	commands map[string]int
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type item struct {
+	value   string
+	expires time.Time // 零值表示不过期
+}
+
+// NewServer 在127.0.0.1的随机端口上启动服务器
+func NewServer() (*Server, error) {
+	return NewServerWithPassword("")
+}
+
+// NewServerWithPassword 启动需要AUTH认证的服务器
+func NewServerWithPassword(password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s := &Server{
+		listener: listener,
+		password: password,
+		data:     make(map[string]item),
+		commands: make(map[string]int),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Get 直接读取未过期的值
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.lookup(key)
+	return it.value, ok
+}
+
+// TTL 返回key的剩余有效期，不存在或不过期时返回0
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.lookup(key)
+	if !ok || it.expires.IsZero() {
+		return 0
+	}
+	return time.Until(it.expires)
+}
+
+// Len 返回未过期的key数量
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key := range s.data {
+		if _, ok := s.lookup(key); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Commands 返回某个命令（大写）被执行的次数
+func (s *Server) Commands(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands[name]
+}
+
+// lookup 查找key，已过期的顺便删除，调用方持有锁
+func (s *Server) lookup(key string) (item, bool) {
+	it, ok := s.data[key]
+	if !ok {
+		return item{}, false
+	}
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		delete(s.data, key)
+		return item{}, false
+	}
+	return it, true
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// handle 逐条读取命令并回复，直到连接关闭
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := s.password == ""
+
+	for {
+		request, err := storage.ReadRESP(r)
+		if err != nil {
+			return
+		}
+		args, ok := toArgs(request)
+		if !ok || len(args) == 0 {
+			writeError(w, "ERR Protocol error: expected array of bulk strings")
+		} else {
+			authed = s.exec(w, args, authed)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec 执行一条命令，返回连接之后的认证状态
+func (s *Server) exec(w *bufio.Writer, args []string, authed bool) bool {
+	name := strings.ToUpper(args[0])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[name]++
+
+	if name == "AUTH" {
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'auth' command")
+			return authed
+		}
+		if s.password == "" || args[1] != s.password {
+			writeError(w, "WRONGPASS invalid password")
+			return authed
+		}
+		writeSimple(w, "OK")
+		return true
+	}
+	if !authed {
+		writeError(w, "NOAUTH Authentication required.")
+		return false
+	}
+
+	switch name {
+	case "PING":
+		writeSimple(w, "PONG")
+
+	case "SELECT":
+		writeSimple(w, "OK")
+
+	case "GET":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'get' command")
+			break
+		}
+		if it, ok := s.lookup(args[1]); ok {
+			writeBulk(w, it.value)
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+
+	case "SET":
+		s.set(w, args)
+
+	case "DEL", "EXISTS":
+		if len(args) < 2 {
+			writeError(w, "ERR wrong number of arguments for '"+strings.ToLower(name)+"' command")
+			break
+		}
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(key); ok {
+				n++
+				if name == "DEL" {
+					delete(s.data, key)
+				}
+			}
+		}
+		writeInt(w, int64(n))
+
+	case "PTTL":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'pttl' command")
+			break
+		}
+		it, ok := s.lookup(args[1])
+		switch {
+		case !ok:
+			writeInt(w, -2)
+		case it.expires.IsZero():
+			writeInt(w, -1)
+		default:
+			writeInt(w, time.Until(it.expires).Milliseconds())
+		}
+
+	case "DBSIZE":
+		n := 0
+		for key := range s.data {
+			if _, ok := s.lookup(key); ok {
+				n++
+			}
+		}
+		writeInt(w, int64(n))
+
+	case "FLUSHALL", "FLUSHDB":
+		s.data = make(map[string]item)
+		writeSimple(w, "OK")
+
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	return true
+}
+
+// set 处理 SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (s *Server) set(w *bufio.Writer, args []string) {
+	if len(args) < 3 {
+		writeError(w, "ERR wrong number of arguments for 'set' command")
+		return
+	}
+
+	var expires time.Time
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				writeError(w, "ERR syntax error")
+				return
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				unit = time.Second
+			}
+			expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	_, exists := s.lookup(args[1])
+	if (nx && exists) || (xx && !exists) {
+		w.WriteString("$-1\r\n")
+		return
+	}
+
+	s.data[args[1]] = item{value: args[2], expires: expires}
+	writeSimple(w, "OK")
+}
+
+// toArgs 将请求转换为字符串参数
+func toArgs(request interface{}) ([]string, bool) {
+	items, ok := request.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	args := make([]string, len(items))
+	for i, it := range items {
+		if args[i], ok = it.(string); !ok {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
@@ -0,0 +1,23 @@
+package storage
+
+import "time"
+
+// Rule 条件跳转规则，设置了的条件全部满足时跳转到URL，未设置的条件不参与匹配
+type Rule struct {
+	URL       string            `json:"url"`
+	Device    string            `json:"device,omitempty"`     // 访问设备：ios、android、mobile、desktop
+	UserAgent string            `json:"user_agent,omitempty"` // User-Agent包含的子串，不区分大小写
+	Languages []string          `json:"languages,omitempty"`  // 访问者首选语言之一，如zh匹配zh-CN，en-US只匹配en-US
+	Start     *time.Time        `json:"start,omitempty"`      // 生效时间（含）
+	End       *time.Time        `json:"end,omitempty"`        // 失效时间（不含）
+	Query     map[string]string `json:"query,omitempty"`      // 查询参数，值为空时只要求参数存在
+}
+
+// URLs 返回长URL和所有规则的目标URL，用于拦截名单检查
+func (m *URLMapping) URLs() []string {
+	urls := []string{m.LongURL}
+	for _, rule := range m.Rules {
+		urls = append(urls, rule.URL)
+	}
+	return urls
+}
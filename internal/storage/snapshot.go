@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// warmupBatch 预热时每次查询数据库的短URL数量
+const warmupBatch = 500
+
+// Snapshot 热点短URL快照，只记录短URL和命中次数，长URL在预热时从数据库重新读取
+type Snapshot struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Entries   []SnapshotEntry `json:"entries"`
+}
+
+// SnapshotEntry 快照中的一个热点短URL
+type SnapshotEntry struct {
+	Code string `json:"code"`
+	Hits int64  `json:"hits"`
+}
+
+// WriteSnapshot 将缓存中最热的条目写入快照文件，先写临时文件再重命名
+func (s *LayeredStorage) WriteSnapshot() error {
+	if s.snapshotPath == "" || s.warmupSize <= 0 {
+		return nil
+	}
+
+	items := s.cache.Hottest(s.warmupSize)
+	if len(items) == 0 {
+		// 没有新的访问，保留上一次的快照
+		return nil
+	}
+
+	snapshot := Snapshot{
+		CreatedAt: time.Now(),
+		Entries:   make([]SnapshotEntry, len(items)),
+	}
+	for i, item := range items {
+		snapshot.Entries[i] = SnapshotEntry{Code: item.Key, Hits: item.Hits}
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.snapshotPath), 0755); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	tmp := s.snapshotPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, s.snapshotPath); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot 读取快照文件
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// warmUp 启动时预热缓存：优先使用快照，没有可用快照时加载访问量最高的短URL
+func (s *LayeredStorage) warmUp() error {
+	if s.warmupSize <= 0 {
+		return nil
+	}
+
+	if s.snapshotPath != "" {
+		if snapshot, err := ReadSnapshot(s.snapshotPath); err == nil && len(snapshot.Entries) > 0 {
+			codes := make([]string, 0, len(snapshot.Entries))
+			for _, entry := range snapshot.Entries {
+				if len(codes) == s.warmupSize {
+					break
+				}
+				codes = append(codes, entry.Code)
+			}
+			return s.warmFromCodes(codes)
+		}
+	}
+
+	return s.warmFromTopAccess()
+}
+
+// warmFromCodes 从数据库读取快照中仍然有效的短URL，最冷的先写入，使最热的条目位于LRU头部
+func (s *LayeredStorage) warmFromCodes(codes []string) error {
+	values := make(map[string]string, len(codes))
+	now := time.Now()
+
+	for start := 0; start < len(codes); start += warmupBatch {
+		end := start + warmupBatch
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		var mappings []URLMapping
+		err := s.db.Where("short_code IN ? AND expires_at > ?", codes[start:end], now).
+			Find(&mappings).Error
+		if err != nil {
+			return fmt.Errorf("failed to warm up cache: %w", err)
+		}
+		for _, m := range mappings {
+			values[m.ShortCode] = targetOf(&m).encode()
+		}
+	}
+
+	for i := len(codes) - 1; i >= 0; i-- {
+		if value, ok := values[codes[i]]; ok {
+			s.cache.Put(codes[i], value)
+			s.warmed++
+		}
+	}
+	return nil
+}
+
+// warmFromTopAccess 加载未过期且访问量最高的短URL
+func (s *LayeredStorage) warmFromTopAccess() error {
+	var mappings []URLMapping
+	err := s.db.Where("expires_at > ?", time.Now()).
+		Order("access_count DESC").
+		Limit(s.warmupSize).
+		Find(&mappings).Error
+	if err != nil {
+		return fmt.Errorf("failed to warm up cache: %w", err)
+	}
+
+	for i := len(mappings) - 1; i >= 0; i-- {
+		s.cache.Put(mappings[i].ShortCode, targetOf(&mappings[i]).encode())
+		s.warmed++
+	}
+	return nil
+}
+
+// runSnapshots 定期写入热点快照，直到stop关闭
+func (s *LayeredStorage) runSnapshots(interval time.Duration) {
+	defer close(s.snapshotDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.WriteSnapshot(); err != nil {
+				s.snapshotErr.Store(err.Error())
+				slog.Warn("failed to write hot link snapshot", "path", s.snapshotPath, "error", err)
+			}
+		case <-s.stopSnapshot:
+			return
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package storage
 
 import (
-	"container/list"
+	"context"
+	"errors"
 	"fmt"
+	"fuxi/internal/generator"
+	"fuxi/internal/singleflight"
+	"fuxi/internal/tracing"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -17,15 +26,58 @@ type URLMapping struct {
 	ShortCode   string    `gorm:"uniqueIndex;size:20;not null"`
 	LongURL     string    `gorm:"size:2048;not null"`
 	AccessCount int64     `gorm:"default:0"`
+	OwnerID     uint      `gorm:"index;default:0"` // 创建该短URL的API Key，0表示无归属
 	ExpiresAt   time.Time `gorm:"index"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	DisabledReason string     `gorm:"size:255;not null;default:''"` // 停用原因，非空时重定向返回警告页
+	DisabledAt     *time.Time `gorm:"index"`
+	ReviewedAt     *time.Time // 管理员确认目标安全并恢复的时间，非空时后台检查不再停用，修改目标地址后清除
+
+	Interstitial bool      `gorm:"not null;default:false"`       // 总是先显示预览页，由访问者确认后再跳转
+	RedirectType int       `gorm:"not null;default:302"`         // 重定向状态码：301、302、307、308
+	ForwardQuery bool      `gorm:"not null;default:false"`       // 把访问时的查询参数合并到目标URL
+	ForwardPath  bool      `gorm:"not null;default:false"`       // 把短URL之后的路径（/:code/*rest）追加到目标URL
+	UTM          UTMParams `gorm:"embedded;embeddedPrefix:utm_"` // 目标URL中没有对应参数时添加的UTM参数
+
+	Rules []Rule `gorm:"type:text;serializer:json"` // 按顺序匹配的条件跳转规则，都不匹配时跳转到LongURL
 }
 
+// loadTimeout 合并后的数据库查询的超时，与发起查询的请求是否取消无关
+const loadTimeout = 5 * time.Second
+
+// l2Tombstone 修改或删除后写入二级缓存的占位值，不是合法的缓存值（长URL或以"{"开头的JSON）
+//
+// 与修改并发的查询可能在修改之前读到旧记录，之后才回填二级缓存；回填只在key不存在时写入，
+// 占位值存在期间（超过一次数据库查询的最长耗时）旧值无法写回。
+const l2Tombstone = "!evicted"
+
+// l2TombstoneTTL 占位值的有效期
+const l2TombstoneTTL = 2 * loadTimeout
+
+// ErrNotFound 短URL不存在或已过期
+var ErrNotFound = errors.New("short URL not found or expired")
+
 // Storage 存储接口
 type Storage interface {
 	Save(code, longURL string) error
+	SaveContext(ctx context.Context, code, longURL string) error
+	SaveMapping(ctx context.Context, mapping *URLMapping) error
 	Get(code string) (string, error)
+	GetContext(ctx context.Context, code string) (string, error)
+	GetTarget(ctx context.Context, code string) (*Target, error)
+	GetMapping(code string) (*URLMapping, error)
+	ListMappings(ownerID uint, limit, offset int) ([]URLMapping, int64, error)
+	ScanMappings(afterID uint, limit int) ([]URLMapping, error)
+	Update(code, longURL string) error
+	UpdateOwned(ownerID uint, code, longURL string) error
+	UpdateRules(code, fallbackURL string, rules []Rule) error
+	UpdateRulesOwned(ownerID uint, code, fallbackURL string, rules []Rule) error
+	Delete(code string) error
+	DeleteOwned(ownerID uint, code string) error
+	DisableMapping(code, reason string) error
+	EnableMapping(code string) error
 	IncrementAccess(code string) error
 	GetStats() (*Stats, error)
 	Close() error
@@ -38,18 +90,120 @@ type Stats struct {
 	ActiveURLs   int64
 	ExpiredURLs  int64
 	CacheHitRate float64
+
+	CacheSize       int   // 缓存条目数
+	CacheBytes      int64 // 缓存估算占用字节数
+	CacheHits       int64 // 缓存命中次数
+	CacheMisses     int64 // 缓存未命中次数
+	CacheInsertions int64 // 缓存新写入条目数
+	CacheEvictions  int64 // 缓存淘汰条目数
+
+	CacheHitRate1m  float64 // 最近1分钟缓存命中率
+	CacheHitRate5m  float64 // 最近5分钟缓存命中率
+	CacheHitRate15m float64 // 最近15分钟缓存命中率
+
+	CacheHitLatency Latency // Get在本地缓存命中时的耗时
+	FallbackLatency Latency // Get在本地缓存未命中、回退到二级缓存或数据库时的耗时
+	L2Latency       Latency // 二级缓存读取耗时
+	DBLatency       Latency // 数据库查询耗时
+
+	NegativeHits int64 // 由负缓存或布隆过滤器拦截、未查询数据库的请求数
+	InvalidCodes int64 // 长度或字符集不合法、直接拒绝的请求数
+
+	CoalescedLookups int64 // 缓存未命中时共享了其他请求查询结果的次数
+
+	WarmedEntries int    // 启动时预热写入缓存的条目数
+	SnapshotError string // 最近一次写入热点快照失败的原因
+
+	L2Hits   int64 // 二级缓存命中次数
+	L2Misses int64 // 二级缓存未命中次数
+	L2Errors int64 // 二级缓存读写失败次数（失败时回退到数据库）
+
+	Invalidations      int64 // 收到的失效消息数（包括本实例发出的）
+	InvalidationErrors int64 // 发布失效消息失败的次数
+}
+
+// Config 分层存储配置
+type Config struct {
+	DBPath      string // SQLite数据库文件路径
+	CacheSize   int    // 缓存容量（条目数）
+	CacheBytes  int64  // 缓存内存预算（字节），大于0时按字节淘汰并忽略CacheSize
+	CachePolicy string // 缓存淘汰策略：lru、tinylfu、arc，默认lru
+
+	NegativeTTL  time.Duration // "未找到"结果的缓存时长，0表示不启用负缓存
+	NegativeSize int           // 负缓存容量，默认10万
+	BloomSize    int           // 已发放短URL布隆过滤器的位数，0表示不启用
+	CodeLengths  []int         // 合法的短URL长度，非空时同时校验长度和字符集
+
+	SnapshotPath     string        // 热点快照文件路径，为空时不读写快照
+	SnapshotInterval time.Duration // 写入热点快照的间隔，0表示只在关闭时写入
+	WarmupSize       int           // 快照记录和启动预热的条目数，0表示不预热
+
+	Redis    RedisOptions  // Redis二级缓存，Addr为空时不启用
+	L2MaxTTL time.Duration // 二级缓存条目的最长有效期，0表示与短URL过期时间一致
+
+	Bus InvalidationBus // 多实例缓存失效广播，可为nil
 }
 
 // LayeredStorage 分层存储实现
 type LayeredStorage struct {
 	db    *gorm.DB
-	cache *LRUCache
+	cache Cache
+
+	negative    *NegativeCache                        // 负缓存，可为nil
+	bloom       atomic.Pointer[generator.BloomFilter] // 已发放短URL的布隆过滤器，可为nil
+	bloomSize   int                                   // 配置的布隆过滤器位数，重建时使用
+	bloomMu     sync.Mutex                            // 保护bloomNext
+	bloomNext   *generator.BloomFilter                // 正在重建的过滤器，重建期间新建的短URL同时写入
+	rebuildMu   sync.Mutex                            // 串行化布隆过滤器重建
+	codeLengths map[int]bool                          // 合法的短URL长度，为空时不校验
+	negHits     atomic.Int64
+	invalid     atomic.Int64
+
+	flight   singleflight.Group // 合并同一短URL的并发数据库查询
+	coalesce atomic.Int64       // 共享其他请求查询结果的次数
+
+	snapshotPath string
+	warmupSize   int
+	warmed       int
+	snapshotErr  atomic.Value  // string，最近一次写快照的错误
+	stopSnapshot chan struct{} // 关闭时停止定期快照，为nil表示未启动
+	snapshotDone chan struct{}
+
+	l2       L2Cache // 二级缓存，可为nil
+	l2MaxTTL time.Duration
+	l2Hits   atomic.Int64
+	l2Misses atomic.Int64
+	l2Errors atomic.Int64
+
+	bus           InvalidationBus // 失效广播，可为nil
+	invalidations atomic.Int64
+	publishErrors atomic.Int64
+
+	hitLatency      latencyStat
+	fallbackLatency latencyStat
+	l2Latency       latencyStat
+	dbLatency       latencyStat
 }
 
-// NewLayeredStorage 创建分层存储
+// NewLayeredStorage 创建使用LRU缓存的分层存储
 func NewLayeredStorage(dbPath string, cacheSize int) (*LayeredStorage, error) {
+	return NewLayeredStorageWithConfig(Config{
+		DBPath:    dbPath,
+		CacheSize: cacheSize,
+	})
+}
+
+// NewLayeredStorageWithConfig 按配置创建分层存储
+func NewLayeredStorageWithConfig(cfg Config) (*LayeredStorage, error) {
+	// 创建缓存
+	cache, err := NewCache(cfg.CachePolicy, cfg.CacheSize, cfg.CacheBytes)
+	if err != nil {
+		return nil, err
+	}
+
 	// 初始化SQLite数据库
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	db, err := gorm.Open(sqlite.Open(cfg.DBPath), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
@@ -57,64 +211,543 @@ func NewLayeredStorage(dbPath string, cacheSize int) (*LayeredStorage, error) {
 	}
 
 	// 自动迁移表结构
-	err = db.AutoMigrate(&URLMapping{})
+	err = db.AutoMigrate(&URLMapping{}, &APIKey{}, &DailyQuota{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate: %w", err)
 	}
 
-	// 创建LRU缓存
-	cache := NewLRUCache(cacheSize)
+	s := &LayeredStorage{
+		db:           db,
+		cache:        cache,
+		snapshotPath: cfg.SnapshotPath,
+		warmupSize:   cfg.WarmupSize,
+		l2MaxTTL:     cfg.L2MaxTTL,
+		bus:          cfg.Bus,
+	}
+
+	// 二级缓存
+	if cfg.Redis.Addr != "" {
+		s.l2, err = NewRedisCache(cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 负查找层
+	if cfg.NegativeTTL > 0 {
+		size := cfg.NegativeSize
+		if size <= 0 {
+			size = 100000
+		}
+		s.negative = NewNegativeCache(cfg.NegativeTTL, size)
+	}
+	if len(cfg.CodeLengths) > 0 {
+		s.codeLengths = make(map[int]bool)
+		for _, n := range cfg.CodeLengths {
+			s.codeLengths[n] = true
+		}
+	}
+	if cfg.BloomSize > 0 {
+		s.bloomSize = cfg.BloomSize
+		if err := s.rebuildBloom(cfg.BloomSize); err != nil {
+			return nil, err
+		}
+	}
 
-	return &LayeredStorage{
-		db:    db,
-		cache: cache,
-	}, nil
+	// 订阅其他实例的变更
+	if s.bus != nil {
+		s.bus.Subscribe(s.applyInvalidation)
+	}
+
+	// 预热缓存，在开始接收请求之前完成
+	if err := s.warmUp(); err != nil {
+		return nil, err
+	}
+	if s.snapshotPath != "" && cfg.SnapshotInterval > 0 {
+		s.stopSnapshot = make(chan struct{})
+		s.snapshotDone = make(chan struct{})
+		go s.runSnapshots(cfg.SnapshotInterval)
+	}
+
+	return s, nil
+}
+
+// rebuildBloom 从URLMapping加载全部已发放短URL，构建布隆过滤器后替换当前的过滤器。
+// 重建期间新建的短URL可能不在读到的行里，由addToBloom同时写入新过滤器
+func (s *LayeredStorage) rebuildBloom(size int) (err error) {
+	s.rebuildMu.Lock()
+	defer s.rebuildMu.Unlock()
+
+	var total int64
+	s.db.Model(&URLMapping{}).Count(&total)
+
+	// 位数至少为已有数量的10倍，控制误判率
+	if min := int(total) * 10; size < min {
+		size = min
+	}
+	bloom := generator.NewBloomFilter(size)
+	s.bloomMu.Lock()
+	s.bloomNext = bloom
+	s.bloomMu.Unlock()
+	defer func() {
+		s.bloomMu.Lock()
+		defer s.bloomMu.Unlock()
+		s.bloomNext = nil
+		if err == nil {
+			s.bloom.Store(bloom)
+		}
+	}()
+
+	rows, err := s.db.Model(&URLMapping{}).Select("short_code").Rows()
+	if err != nil {
+		return fmt.Errorf("failed to load short codes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return fmt.Errorf("failed to load short codes: %w", err)
+		}
+		bloom.Add(code)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load short codes: %w", err)
+	}
+	return nil
+}
+
+// addToBloom 记录新发放的短URL，重建中的过滤器也一并写入
+func (s *LayeredStorage) addToBloom(code string) {
+	if s.bloomSize == 0 {
+		return
+	}
+	s.bloomMu.Lock()
+	defer s.bloomMu.Unlock()
+	if bloom := s.bloom.Load(); bloom != nil {
+		bloom.Add(code)
+	}
+	if s.bloomNext != nil {
+		s.bloomNext.Add(code)
+	}
+}
+
+// validCode 检查短URL长度和字符集，未配置合法长度时不校验
+func (s *LayeredStorage) validCode(code string) bool {
+	if len(s.codeLengths) == 0 {
+		return true
+	}
+	return s.codeLengths[len(code)] && generator.IsValidCode(code)
+}
+
+// knownMissing 布隆过滤器确定不存在，或负缓存记录为未找到
+func (s *LayeredStorage) knownMissing(code string) bool {
+	if bloom := s.bloom.Load(); bloom != nil && !bloom.Contains(code) {
+		return true
+	}
+	return s.negative != nil && s.negative.Contains(code)
 }
 
 // Save 保存短URL映射
 func (s *LayeredStorage) Save(code, longURL string) error {
-	mapping := &URLMapping{
-		ShortCode: code,
-		LongURL:   longURL,
-		ExpiresAt: time.Now().Add(2 * 365 * 24 * time.Hour), // 2年有效期
+	return s.SaveContext(context.Background(), code, longURL)
+}
+
+// SaveContext 保存短URL映射，ctx中的span作为父span
+func (s *LayeredStorage) SaveContext(ctx context.Context, code, longURL string) error {
+	return s.SaveMapping(ctx, &URLMapping{ShortCode: code, LongURL: longURL})
+}
+
+// SaveMapping 保存完整的映射记录（如带有OwnerID），ExpiresAt和RedirectType为零值时使用默认值
+func (s *LayeredStorage) SaveMapping(ctx context.Context, mapping *URLMapping) (err error) {
+	code := mapping.ShortCode
+	ctx, span := tracer.Start(ctx, "LayeredStorage.Save", trace.WithAttributes(attribute.String("short_code", code)))
+	defer func() { tracing.End(span, err) }()
+
+	if mapping.ExpiresAt.IsZero() {
+		mapping.ExpiresAt = time.Now().Add(2 * 365 * 24 * time.Hour) // 2年有效期
+	}
+	if mapping.RedirectType == 0 {
+		mapping.RedirectType = DefaultRedirectType
 	}
 
-	result := s.db.Create(mapping)
+	_, dbSpan := startDBSpan(ctx, "INSERT")
+	start := time.Now()
+	result := s.db.WithContext(ctx).Create(mapping)
+	observeQuery("save", start)
+	tracing.End(dbSpan, result.Error)
 	if result.Error != nil {
+		slog.ErrorContext(ctx, "failed to save mapping", "short_code", code, "error", result.Error)
 		return result.Error
 	}
 
-	// 写入缓存
-	s.cache.Put(code, longURL)
+	// 写入缓存，清除负查找记录
+	value := targetOf(mapping).encode()
+	s.cache.Put(code, value)
+	s.setL2(ctx, code, value, mapping.ExpiresAt, false)
+	s.addToBloom(code)
+	if s.negative != nil {
+		s.negative.Remove(code)
+	}
+	s.publish(OpCreate, code)
+
+	return nil
+}
+
+// GetMapping 从数据库读取未过期的完整映射记录（不经过缓存），用于管理接口
+func (s *LayeredStorage) GetMapping(code string) (*URLMapping, error) {
+	var mapping URLMapping
+	start := time.Now()
+	err := s.db.Where("short_code = ? AND expires_at > ?", code, start).First(&mapping).Error
+	observeQuery("get", start)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// ListMappings 按创建时间倒序分页返回某个API Key创建的未过期短URL，以及总数
+func (s *LayeredStorage) ListMappings(ownerID uint, limit, offset int) ([]URLMapping, int64, error) {
+	query := s.db.Model(&URLMapping{}).Where("owner_id = ? AND expires_at > ?", ownerID, time.Now())
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var mappings []URLMapping
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&mappings).Error; err != nil {
+		return nil, 0, err
+	}
+	return mappings, total, nil
+}
+
+// Update 修改短URL的目标地址，并使所有实例的缓存失效
+func (s *LayeredStorage) Update(code, longURL string) error {
+	return s.update(s.db, code, &URLMapping{LongURL: longURL}, "long_url")
+}
+
+// UpdateOwned 只修改ownerID创建的短URL，不属于该Key时返回ErrNotFound
+func (s *LayeredStorage) UpdateOwned(ownerID uint, code, longURL string) error {
+	return s.update(s.db.Where("owner_id = ?", ownerID), code, &URLMapping{LongURL: longURL}, "long_url")
+}
+
+// UpdateRules 替换短URL的条件跳转规则和规则都不匹配时的目标地址，rules为空时清除规则
+func (s *LayeredStorage) UpdateRules(code, fallbackURL string, rules []Rule) error {
+	return s.update(s.db, code, &URLMapping{LongURL: fallbackURL, Rules: rules}, "long_url", "rules")
+}
+
+// UpdateRulesOwned 只修改ownerID创建的短URL的规则，不属于该Key时返回ErrNotFound
+func (s *LayeredStorage) UpdateRulesOwned(ownerID uint, code, fallbackURL string, rules []Rule) error {
+	return s.update(s.db.Where("owner_id = ?", ownerID), code, &URLMapping{LongURL: fallbackURL, Rules: rules}, "long_url", "rules")
+}
+
+// update 在scope限定的范围内修改columns列出的目标地址字段，管理员对原目标的确认随之失效
+func (s *LayeredStorage) update(scope *gorm.DB, code string, values *URLMapping, columns ...string) error {
+	start := time.Now()
+	result := scope.Model(&URLMapping{}).
+		Where("short_code = ? AND expires_at > ?", code, start).
+		Select(append(columns, "reviewed_at")).Updates(values)
+	observeQuery("update", start)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	s.evict(code)
+	s.publish(OpUpdate, code)
+	return nil
+}
+
+// ScanMappings 按ID顺序返回afterID之后未过期且未停用的短URL，用于后台批量检查
+func (s *LayeredStorage) ScanMappings(afterID uint, limit int) ([]URLMapping, error) {
+	var mappings []URLMapping
+	err := s.db.Where("id > ? AND expires_at > ? AND disabled_at IS NULL", afterID, time.Now()).
+		Order("id").Limit(limit).Find(&mappings).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan mappings: %w", err)
+	}
+	return mappings, nil
+}
+
+// DisableMapping 停用短URL并记录原因，重定向改为返回警告页，同时撤销管理员的确认
+func (s *LayeredStorage) DisableMapping(code, reason string) error {
+	return s.setDisabled(code, map[string]any{"disabled_reason": reason, "disabled_at": time.Now(), "reviewed_at": nil})
+}
+
+// EnableMapping 恢复被停用的短URL并记录管理员的确认，后台检查不再因拦截名单停用它
+func (s *LayeredStorage) EnableMapping(code string) error {
+	return s.setDisabled(code, map[string]any{"disabled_reason": "", "disabled_at": nil, "reviewed_at": time.Now()})
+}
+
+// setDisabled 修改停用状态，并使所有实例的缓存失效
+func (s *LayeredStorage) setDisabled(code string, fields map[string]any) error {
+	start := time.Now()
+	result := s.db.Model(&URLMapping{}).Where("short_code = ?", code).Updates(fields)
+	observeQuery("update", start)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update mapping: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	s.evict(code)
+	s.publish(OpUpdate, code)
+	return nil
+}
 
+// Delete 删除短URL，并使所有实例的缓存失效
+func (s *LayeredStorage) Delete(code string) error {
+	return s.delete(s.db, code)
+}
+
+// DeleteOwned 只删除ownerID创建的短URL，不属于该Key时返回ErrNotFound
+func (s *LayeredStorage) DeleteOwned(ownerID uint, code string) error {
+	return s.delete(s.db.Where("owner_id = ?", ownerID), code)
+}
+
+// delete 在scope限定的范围内删除短URL
+func (s *LayeredStorage) delete(scope *gorm.DB, code string) error {
+	start := time.Now()
+	result := scope.Where("short_code = ?", code).Delete(&URLMapping{})
+	observeQuery("delete", start)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	s.evict(code)
+	s.publish(OpDelete, code)
 	return nil
 }
 
+// evict 从本地缓存中删除，二级缓存中替换为占位值，防止并发查询回填修改前的值
+func (s *LayeredStorage) evict(code string) {
+	s.cache.Remove(code)
+	if s.l2 != nil {
+		if err := s.l2.Set(code, l2Tombstone, l2TombstoneTTL); err != nil {
+			s.l2Errors.Add(1)
+			slog.Warn("l2 cache delete failed", "short_code", code, "error", err)
+		}
+	}
+}
+
+// publish 广播变更，失败时只计数，数据库中的修改已经生效
+func (s *LayeredStorage) publish(op InvalidationOp, code string) {
+	if s.bus == nil {
+		return
+	}
+	if err := s.bus.Publish(Invalidation{Op: op, Code: code}); err != nil {
+		s.publishErrors.Add(1)
+		slog.Warn("failed to publish cache invalidation", "op", op, "short_code", code, "error", err)
+	}
+}
+
+// applyInvalidation 处理失效消息，本实例发出的消息也会收到，处理是幂等的
+func (s *LayeredStorage) applyInvalidation(msg Invalidation) {
+	s.invalidations.Add(1)
+
+	switch msg.Op {
+	case OpCreate:
+		// 其他实例新建的短URL不应再被布隆过滤器或负缓存拦截
+		s.addToBloom(msg.Code)
+		if s.negative != nil {
+			s.negative.Remove(msg.Code)
+		}
+	case OpUpdate, OpDelete:
+		s.cache.Remove(msg.Code)
+	case OpReset:
+		// 漏掉的修改和删除可能留下旧缓存，漏掉的新建可能被负缓存和布隆过滤器拦截，
+		// 因此清空缓存并从数据库重建布隆过滤器
+		s.cache.Clear()
+		if s.negative != nil {
+			s.negative.Clear()
+		}
+		if s.bloomSize > 0 {
+			if err := s.rebuildBloom(s.bloomSize); err != nil {
+				slog.Error("failed to rebuild bloom filter after invalidation reset", "error", err)
+			}
+		}
+	}
+}
+
 // Get 获取长URL
 func (s *LayeredStorage) Get(code string) (string, error) {
-	// 1. 先查缓存
-	if longURL, ok := s.cache.Get(code); ok {
-		return longURL, nil
+	return s.GetContext(context.Background(), code)
+}
+
+// GetContext 获取长URL，短URL已停用时返回ErrDisabled
+func (s *LayeredStorage) GetContext(ctx context.Context, code string) (string, error) {
+	target, err := s.GetTarget(ctx, code)
+	if err != nil {
+		return "", err
+	}
+	if target.Disabled() {
+		return "", ErrDisabled
+	}
+	return target.URL, nil
+}
+
+// GetTarget 获取重定向目标（包括已停用的），ctx中的span作为父span，span的cache.result属性记录由哪一层返回
+func (s *LayeredStorage) GetTarget(ctx context.Context, code string) (target *Target, err error) {
+	ctx, span := tracer.Start(ctx, "LayeredStorage.Get", trace.WithAttributes(attribute.String("short_code", code)))
+	defer func() {
+		if errors.Is(err, ErrNotFound) {
+			// 未找到是正常结果，不标记为错误
+			tracing.End(span, nil)
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	// 1. 不可能存在的短URL直接拒绝
+	if !s.validCode(code) {
+		s.invalid.Add(1)
+		span.SetAttributes(attribute.String("cache.result", "invalid"))
+		return nil, ErrNotFound
+	}
+
+	// 2. 查缓存
+	start := time.Now()
+	if value, ok := s.cache.Get(code); ok {
+		target, err := decodeTarget(value)
+		if err != nil || !target.Expired(start) {
+			s.hitLatency.since(start)
+			span.SetAttributes(attribute.String("cache.result", "hit"))
+			return target, err
+		}
+		// 缓存中的短URL已过期，按未命中处理，之后的请求由负缓存拦截
+		s.cache.Remove(code)
+		if s.negative != nil {
+			s.negative.Add(code)
+		}
+		span.SetAttributes(attribute.String("cache.result", "expired"))
+		return nil, ErrNotFound
+	}
+
+	// 3. 缓存未命中，已知不存在的不查数据库
+	if s.knownMissing(code) {
+		s.negHits.Add(1)
+		negativeHitsMetric.Inc()
+		span.SetAttributes(attribute.String("cache.result", "negative"))
+		return nil, ErrNotFound
+	}
+
+	// 4. 查数据库，同一短URL的并发未命中只执行一次查询。
+	// 查询结果由所有等待者共享，不能因第一个调用方断开连接而取消，
+	// 因此只保留ctx中的span等值，改用独立的超时
+	value, err, shared := s.flight.Do(code, func() (string, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		return s.load(loadCtx, code)
+	})
+	if shared {
+		s.coalesce.Add(1)
+	}
+	s.fallbackLatency.since(start)
+	span.SetAttributes(attribute.String("cache.result", "miss"), attribute.Bool("coalesced", shared))
+	if err != nil {
+		return nil, err
+	}
+	return decodeTarget(value)
+}
+
+// load 依次查二级缓存和数据库，回填上层缓存，返回编码后的缓存值
+func (s *LayeredStorage) load(ctx context.Context, code string) (string, error) {
+	if s.l2 != nil {
+		_, l2Span := tracer.Start(ctx, "l2.get")
+		start := time.Now()
+		value, ok, err := s.l2.Get(code)
+		s.l2Latency.since(start)
+		l2Span.SetAttributes(attribute.Bool("l2.hit", ok))
+		tracing.End(l2Span, err)
+		switch {
+		case err != nil:
+			// 二级缓存不可用时回退到数据库
+			s.l2Errors.Add(1)
+			l2Requests.With("error").Inc()
+			slog.WarnContext(ctx, "l2 cache get failed, falling back to database", "short_code", code, "error", err)
+		case ok && value != l2Tombstone:
+			s.l2Hits.Add(1)
+			l2Requests.With("hit").Inc()
+			s.cache.Put(code, value)
+			return value, nil
+		default:
+			s.l2Misses.Add(1)
+			l2Requests.With("miss").Inc()
+		}
 	}
 
-	// 2. 缓存未命中，查数据库
 	var mapping URLMapping
-	result := s.db.Where("short_code = ? AND expires_at > ?", code, time.Now()).First(&mapping)
+	_, dbSpan := startDBSpan(ctx, "SELECT")
+	start := time.Now()
+	result := s.db.WithContext(ctx).Where("short_code = ? AND expires_at > ?", code, start).First(&mapping)
+	dbGetDuration.Observe(s.dbLatency.since(start).Seconds())
+	if result.Error == gorm.ErrRecordNotFound {
+		tracing.End(dbSpan, nil)
+	} else {
+		tracing.End(dbSpan, result.Error)
+	}
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return "", fmt.Errorf("short URL not found or expired")
+			if s.negative != nil {
+				s.negative.Add(code)
+			}
+			return "", ErrNotFound
 		}
+		slog.ErrorContext(ctx, "database lookup failed", "short_code", code, "error", result.Error)
 		return "", result.Error
 	}
 
-	// 3. 写入缓存
-	s.cache.Put(code, mapping.LongURL)
+	// 写入缓存
+	value := targetOf(&mapping).encode()
+	s.cache.Put(code, value)
+	s.setL2(ctx, code, value, mapping.ExpiresAt, true)
 
-	return mapping.LongURL, nil
+	return value, nil
+}
+
+// setL2 写入二级缓存，有效期不超过短URL的过期时间和L2MaxTTL
+//
+// backfill为true表示未命中后的回填，只在key不存在时写入，不覆盖新值或修改留下的占位值。
+func (s *LayeredStorage) setL2(ctx context.Context, code, value string, expiresAt time.Time, backfill bool) {
+	if s.l2 == nil {
+		return
+	}
+	ttl := time.Until(expiresAt)
+	if s.l2MaxTTL > 0 && ttl > s.l2MaxTTL {
+		ttl = s.l2MaxTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	var err error
+	if backfill {
+		_, err = s.l2.Add(code, value, ttl)
+	} else {
+		err = s.l2.Set(code, value, ttl)
+	}
+	if err != nil {
+		s.l2Errors.Add(1)
+		slog.WarnContext(ctx, "l2 cache set failed", "short_code", code, "error", err)
+	}
+}
+
+// DB 返回底层数据库连接
+func (s *LayeredStorage) DB() *gorm.DB {
+	return s.db
 }
 
 // IncrementAccess 增加访问计数
 func (s *LayeredStorage) IncrementAccess(code string) error {
+	defer observeQuery("increment", time.Now())
 	return s.db.Model(&URLMapping{}).
 		Where("short_code = ?", code).
 		UpdateColumn("access_count", gorm.Expr("access_count + 1")).Error
@@ -139,110 +772,64 @@ func (s *LayeredStorage) GetStats() (*Stats, error) {
 	// 缓存命中率
 	stats.CacheHitRate = s.cache.HitRate()
 
-	return stats, nil
-}
-
-// Close 关闭存储
-func (s *LayeredStorage) Close() error {
-	sqlDB, err := s.db.DB()
-	if err != nil {
-		return err
+	// 缓存占用和计数
+	cacheStats := s.cache.Stats()
+	stats.CacheSize = cacheStats.Size
+	stats.CacheBytes = cacheStats.Bytes
+	stats.CacheHits = cacheStats.Hits
+	stats.CacheMisses = cacheStats.Misses
+	stats.CacheInsertions = cacheStats.Insertions
+	stats.CacheEvictions = cacheStats.Evictions
+	stats.CacheHitRate1m = cacheStats.HitRate1m
+	stats.CacheHitRate5m = cacheStats.HitRate5m
+	stats.CacheHitRate15m = cacheStats.HitRate15m
+
+	// 各层耗时
+	stats.CacheHitLatency = s.hitLatency.load()
+	stats.FallbackLatency = s.fallbackLatency.load()
+	stats.L2Latency = s.l2Latency.load()
+	stats.DBLatency = s.dbLatency.load()
+
+	// 负查找
+	stats.NegativeHits = s.negHits.Load()
+	stats.InvalidCodes = s.invalid.Load()
+	stats.CoalescedLookups = s.coalesce.Load()
+
+	// 预热与快照
+	stats.WarmedEntries = s.warmed
+	if msg, ok := s.snapshotErr.Load().(string); ok {
+		stats.SnapshotError = msg
 	}
-	return sqlDB.Close()
-}
 
-// LRUCache LRU缓存实现
-type LRUCache struct {
-	capacity int
-	cache    map[string]*list.Element
-	lruList  *list.List
-	mu       sync.RWMutex
-	hits     int64
-	misses   int64
-}
+	// 二级缓存
+	stats.L2Hits = s.l2Hits.Load()
+	stats.L2Misses = s.l2Misses.Load()
+	stats.L2Errors = s.l2Errors.Load()
 
-type cacheEntry struct {
-	key   string
-	value string
-}
+	// 失效广播
+	stats.Invalidations = s.invalidations.Load()
+	stats.InvalidationErrors = s.publishErrors.Load()
 
-// NewLRUCache 创建LRU缓存
-func NewLRUCache(capacity int) *LRUCache {
-	return &LRUCache{
-		capacity: capacity,
-		cache:    make(map[string]*list.Element),
-		lruList:  list.New(),
-	}
+	return stats, nil
 }
 
-// Get 获取缓存
-func (c *LRUCache) Get(key string) (string, bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if elem, ok := c.cache[key]; ok {
-		c.hits++
-		c.lruList.MoveToFront(elem)
-		return elem.Value.(*cacheEntry).value, true
+// Close 关闭存储，关闭前写入最后一次热点快照
+func (s *LayeredStorage) Close() error {
+	if s.stopSnapshot != nil {
+		close(s.stopSnapshot)
+		<-s.snapshotDone
 	}
-
-	c.misses++
-	return "", false
-}
-
-// Put 写入缓存
-func (c *LRUCache) Put(key, value string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// 如果已存在，更新并移到前面
-	if elem, ok := c.cache[key]; ok {
-		c.lruList.MoveToFront(elem)
-		elem.Value.(*cacheEntry).value = value
-		return
+	snapshotErr := s.WriteSnapshot()
+	if s.l2 != nil {
+		s.l2.Close()
 	}
 
-	// 新增元素
-	entry := &cacheEntry{key: key, value: value}
-	elem := c.lruList.PushFront(entry)
-	c.cache[key] = elem
-
-	// 如果超过容量，删除最久未使用的
-	if c.lruList.Len() > c.capacity {
-		oldest := c.lruList.Back()
-		if oldest != nil {
-			c.lruList.Remove(oldest)
-			delete(c.cache, oldest.Value.(*cacheEntry).key)
-		}
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
 	}
-}
-
-// HitRate 获取缓存命中率
-func (c *LRUCache) HitRate() float64 {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	total := c.hits + c.misses
-	if total == 0 {
-		return 0
+	if err := sqlDB.Close(); err != nil {
+		return err
 	}
-	return float64(c.hits) / float64(total)
-}
-
-// Size 获取当前缓存大小
-func (c *LRUCache) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.lruList.Len()
-}
-
-// Clear 清空缓存
-func (c *LRUCache) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	c.cache = make(map[string]*list.Element)
-	c.lruList = list.New()
-	c.hits = 0
-	c.misses = 0
+	return snapshotErr
 }
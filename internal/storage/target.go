@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultRedirectType 未指定重定向类型时使用的状态码
+const DefaultRedirectType = http.StatusFound
+
+// ValidRedirectType 返回状态码是否是支持的重定向类型
+func ValidRedirectType(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// ErrDisabled 短URL已被停用（如目标命中拦截名单），重定向时应返回警告页
+var ErrDisabled = errors.New("short URL disabled")
+
+// UTMParams 短URL的UTM参数默认值，为空的字段不添加
+type UTMParams struct {
+	Source   string `json:"source,omitempty" gorm:"size:255"`
+	Medium   string `json:"medium,omitempty" gorm:"size:255"`
+	Campaign string `json:"campaign,omitempty" gorm:"size:255"`
+	Term     string `json:"term,omitempty" gorm:"size:255"`
+	Content  string `json:"content,omitempty" gorm:"size:255"`
+}
+
+// IsZero 返回是否没有设置任何UTM参数
+func (u UTMParams) IsZero() bool {
+	return u == UTMParams{}
+}
+
+// Params 按utm_source、utm_medium、utm_campaign、utm_term、utm_content的顺序返回参数名和值
+func (u UTMParams) Params() [][2]string {
+	return [][2]string{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	}
+}
+
+// Target 重定向所需的映射字段，与长URL一起写入本地缓存和二级缓存
+type Target struct {
+	URL            string     `json:"url"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	Interstitial   bool       `json:"interstitial,omitempty"`
+	RedirectType   int        `json:"redirect_type,omitempty"` // 默认值302不写入缓存值
+	ForwardQuery   bool       `json:"forward_query,omitempty"`
+	ForwardPath    bool       `json:"forward_path,omitempty"`
+	UTM            *UTMParams `json:"utm,omitempty"` // 未设置时为nil
+	Rules          []Rule     `json:"rules,omitempty"`
+	ExpiresAt      int64      `json:"expires_at,omitempty"` // 过期时间（Unix毫秒），0表示未记录（旧格式的缓存值）
+}
+
+// Expired 返回短URL在now时是否已过期，与数据库查询的expires_at > now一致
+func (t *Target) Expired(now time.Time) bool {
+	return t.ExpiresAt != 0 && now.UnixMilli() >= t.ExpiresAt
+}
+
+// Disabled 返回短URL是否已停用
+func (t *Target) Disabled() bool {
+	return t.DisabledReason != ""
+}
+
+// Status 返回重定向状态码
+func (t *Target) Status() int {
+	if t.RedirectType == 0 {
+		return DefaultRedirectType
+	}
+	return t.RedirectType
+}
+
+// Permanent 返回是否是永久重定向（301或308），客户端和代理可以缓存
+func (t *Target) Permanent() bool {
+	status := t.Status()
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// PreservesMethod 返回是否保留请求方法和请求体（307或308）
+func (t *Target) PreservesMethod() bool {
+	status := t.Status()
+	return status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect
+}
+
+// targetOf 从映射记录中取出重定向所需的字段
+func targetOf(m *URLMapping) *Target {
+	t := &Target{
+		URL:            m.LongURL,
+		DisabledReason: m.DisabledReason,
+		Interstitial:   m.Interstitial,
+		ForwardQuery:   m.ForwardQuery,
+		ForwardPath:    m.ForwardPath,
+		Rules:          m.Rules,
+	}
+	if !m.ExpiresAt.IsZero() {
+		t.ExpiresAt = m.ExpiresAt.UnixMilli()
+	}
+	if m.RedirectType != DefaultRedirectType {
+		t.RedirectType = m.RedirectType
+	}
+	if !m.UTM.IsZero() {
+		utm := m.UTM
+		t.UTM = &utm
+	}
+	return t
+}
+
+// encode 编码为缓存值
+//
+// 只有长URL时直接保存长URL，与只缓存长URL的旧格式兼容；否则保存JSON。
+// 合法的长URL以scheme开头，不会以"{"开头，两种格式不会混淆。
+// 映射记录都有过期时间，因此新写入的缓存值都是JSON。
+func (t *Target) encode() string {
+	if t.plain() {
+		return t.URL
+	}
+	data, _ := json.Marshal(t)
+	return string(data)
+}
+
+// plain 返回是否除长URL外没有其他设置
+func (t *Target) plain() bool {
+	return t.DisabledReason == "" && !t.Interstitial && t.RedirectType == 0 &&
+		!t.ForwardQuery && !t.ForwardPath && t.UTM == nil && len(t.Rules) == 0 && t.ExpiresAt == 0
+}
+
+// decodeTarget 解码缓存值
+func decodeTarget(value string) (*Target, error) {
+	if !strings.HasPrefix(value, "{") {
+		return &Target{URL: value}, nil
+	}
+	var t Target
+	if err := json.Unmarshal([]byte(value), &t); err != nil {
+		return nil, fmt.Errorf("failed to decode cached target: %w", err)
+	}
+	return &t, nil
+}
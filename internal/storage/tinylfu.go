@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// TinyLFUCache W-TinyLFU缓存实现
+//
+// 新条目先进入占容量1%的窗口LRU；被窗口淘汰的候选只有在访问频率
+// 高于主区（分段LRU）淘汰对象时才被接纳。一次性的扫描请求频率低，
+// 无法挤掉热点条目。
+type TinyLFUCache struct {
+	shardSet
+}
+
+// 条目所在的队列
+const (
+	queueWindow = iota
+	queueProbation
+	queueProtected
+)
+
+type tinyLFUEntry struct {
+	key   string
+	value string
+	size  int64
+	queue int
+	hits  int64
+}
+
+func (e *tinyLFUEntry) cost() int64 {
+	return e.size
+}
+
+// tinyLFUShard 单个W-TinyLFU分片
+type tinyLFUShard struct {
+	mu        sync.Mutex
+	data      map[string]*list.Element
+	queues    [3]*sizedList
+	windowCap budget
+	mainCap   budget
+	protCap   budget
+	sketch    *countMinSketch
+}
+
+// NewTinyLFUCache 创建W-TinyLFU缓存，分片数根据容量自动选择
+func NewTinyLFUCache(capacity int) *TinyLFUCache {
+	return newTinyLFUCache(budget{entries: capacity})
+}
+
+func newTinyLFUCache(b budget) *TinyLFUCache {
+	c := &TinyLFUCache{}
+	c.initShards(b, b.shards(), func(b budget) segment {
+		return newTinyLFUShard(b)
+	})
+	return c
+}
+
+func newTinyLFUShard(b budget) *tinyLFUShard {
+	// 窗口占1%，主区占其余部分，其中80%为保护区
+	windowCap := b.scale(1, 100)
+	mainCap := b
+	if b.limit() > windowCap.limit() {
+		mainCap = b.scale(b.limit()-windowCap.limit(), b.limit())
+	}
+
+	// 草图宽度按条目数估算
+	entries := b.entries
+	if b.bytes > 0 {
+		entries = int(b.bytes / avgEntryBytes)
+	}
+
+	s := &tinyLFUShard{
+		windowCap: windowCap,
+		mainCap:   mainCap,
+		protCap:   mainCap.scale(8, 10),
+		sketch:    newCountMinSketch(entries),
+	}
+	s.reset()
+	return s
+}
+
+func (s *tinyLFUShard) reset() {
+	s.data = make(map[string]*list.Element)
+	for i := range s.queues {
+		s.queues[i] = newSizedList()
+	}
+}
+
+// used 返回队列按计量单位的用量
+func (s *tinyLFUShard) used(b budget, queues ...int) int64 {
+	var entries int
+	var bytes int64
+	for _, q := range queues {
+		entries += s.queues[q].Len()
+		bytes += s.queues[q].size
+	}
+	return b.measure(entries, bytes)
+}
+
+func (s *tinyLFUShard) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sketch.increment(key)
+
+	elem, ok := s.data[key]
+	if !ok {
+		return "", false
+	}
+	s.touch(elem)
+	entry := elem.Value.(*tinyLFUEntry)
+	entry.hits++
+	return entry.value, true
+}
+
+func (s *tinyLFUShard) put(key, value string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := entrySize(key, value)
+	if s.mainCap.cost(size) > s.mainCap.limit() {
+		// 单个条目超过主区上限，不缓存；已缓存的旧值也要删除，否则会继续返回更新前的值
+		if elem, ok := s.data[key]; ok {
+			s.removeElement(elem)
+			return false, 1
+		}
+		return false, 0
+	}
+
+	if elem, ok := s.data[key]; ok {
+		entry := elem.Value.(*tinyLFUEntry)
+		s.queues[entry.queue].size += size - entry.size
+		entry.value = value
+		entry.size = size
+		s.touch(elem)
+		return false, s.evictWindow() + s.evictMain()
+	}
+
+	// 频率只在读取时记录，未命中后回填的写入不重复计数
+	entry := &tinyLFUEntry{key: key, value: value, size: size, queue: queueWindow}
+	s.data[key] = s.queues[queueWindow].pushFront(entry)
+
+	return true, s.evictWindow()
+}
+
+// evictWindow 窗口溢出时，窗口尾部作为候选与主区竞争
+func (s *tinyLFUShard) evictWindow() int {
+	evicted := 0
+	window := s.queues[queueWindow]
+
+	for s.used(s.windowCap, queueWindow) > s.windowCap.limit() && window.Len() > 0 {
+		candidate := window.Back()
+		window.remove(candidate)
+		entry := candidate.Value.(*tinyLFUEntry)
+
+		if s.admitCandidate(entry) {
+			entry.queue = queueProbation
+			s.data[entry.key] = s.queues[queueProbation].pushFront(entry)
+		} else {
+			delete(s.data, entry.key)
+			evicted++
+		}
+
+		evicted += s.evictMain()
+	}
+	return evicted
+}
+
+// admitCandidate 主区有空间时直接接纳，否则候选频率须高于主区淘汰对象
+func (s *tinyLFUShard) admitCandidate(entry *tinyLFUEntry) bool {
+	limit := s.mainCap.limit()
+	if s.mainCap.cost(entry.size) > limit {
+		return false
+	}
+	if s.used(s.mainCap, queueProbation, queueProtected)+s.mainCap.cost(entry.size) <= limit {
+		return true
+	}
+
+	victim := s.mainVictim()
+	if victim == nil {
+		return true
+	}
+	return s.sketch.estimate(entry.key) > s.sketch.estimate(victim.Value.(*tinyLFUEntry).key)
+}
+
+// evictMain 主区超出上限时从试用区（其次保护区）尾部淘汰
+func (s *tinyLFUShard) evictMain() int {
+	evicted := 0
+	for s.used(s.mainCap, queueProbation, queueProtected) > s.mainCap.limit() {
+		victim := s.mainVictim()
+		if victim == nil {
+			break
+		}
+		s.removeElement(victim)
+		evicted++
+	}
+	return evicted
+}
+
+// mainVictim 返回主区的淘汰对象
+func (s *tinyLFUShard) mainVictim() *list.Element {
+	if victim := s.queues[queueProbation].Back(); victim != nil {
+		return victim
+	}
+	return s.queues[queueProtected].Back()
+}
+
+// touch 命中后调整位置：试用区条目晋升到保护区
+func (s *tinyLFUShard) touch(elem *list.Element) {
+	entry := elem.Value.(*tinyLFUEntry)
+	switch entry.queue {
+	case queueWindow, queueProtected:
+		s.queues[entry.queue].MoveToFront(elem)
+	case queueProbation:
+		s.queues[queueProbation].remove(elem)
+		entry.queue = queueProtected
+		s.data[entry.key] = s.queues[queueProtected].pushFront(entry)
+
+		// 保护区溢出时降级到试用区
+		protected := s.queues[queueProtected]
+		for s.used(s.protCap, queueProtected) > s.protCap.limit() && protected.Len() > 1 {
+			demoted := protected.Back()
+			protected.remove(demoted)
+			demotedEntry := demoted.Value.(*tinyLFUEntry)
+			demotedEntry.queue = queueProbation
+			s.data[demotedEntry.key] = s.queues[queueProbation].pushFront(demotedEntry)
+		}
+	}
+}
+
+// removeElement 从所在队列和索引中删除
+func (s *tinyLFUShard) removeElement(elem *list.Element) {
+	entry := elem.Value.(*tinyLFUEntry)
+	s.queues[entry.queue].remove(elem)
+	delete(s.data, entry.key)
+}
+
+func (s *tinyLFUShard) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.data[key]; ok {
+		s.removeElement(elem)
+	}
+}
+
+func (s *tinyLFUShard) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.data)
+}
+
+func (s *tinyLFUShard) bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queues[queueWindow].size + s.queues[queueProbation].size + s.queues[queueProtected].size
+}
+
+func (s *tinyLFUShard) hottest(n int) []CacheItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []CacheItem
+	for _, elem := range s.data {
+		entry := elem.Value.(*tinyLFUEntry)
+		if entry.hits > 0 {
+			items = append(items, CacheItem{Key: entry.key, Value: entry.value, Hits: entry.hits})
+			entry.hits /= 2
+		}
+	}
+	return topItems(items, n)
+}
+
+func (s *tinyLFUShard) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	s.sketch.reset()
+}
+
+// countMinSketch 4行计数最小草图，记录近期访问频率
+//
+// 计数器上限15，累计增量达到采样窗口后全部减半，使频率随时间衰减。
+type countMinSketch struct {
+	rows       [4][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width *= 2
+	}
+
+	s := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes 双重哈希得到每行的位置
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	// FNV-1a 64位
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	h1, h2 := hash, (hash>>32)|1
+
+	var idx [4]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(15)
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < min {
+			min = s.rows[i][idx]
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 存储层的链路追踪，使用全局TracerProvider，未安装时为空操作
+var tracer = otel.Tracer("fuxi/internal/storage")
+
+// startDBSpan 开始一个数据库操作的span
+func startDBSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", "url_mappings"),
+		))
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 导出方式
+const (
+	ExporterNone   = "none"   // 不导出（默认），span只在进程内传播
+	ExporterStdout = "stdout" // 以JSON输出到标准输出，用于本地调试
+	ExporterOTLP   = "otlp"   // 通过OTLP/HTTP发送到Collector
+)
+
+// Config 链路追踪配置
+type Config struct {
+	ServiceName  string  // 服务名称
+	Exporter     string  // 导出方式：none、stdout、otlp
+	OTLPEndpoint string  // OTLP/HTTP地址（host:port），为空时使用OTEL_EXPORTER_OTLP_ENDPOINT或localhost:4318
+	OTLPInsecure bool    // 使用HTTP而不是HTTPS连接Collector
+	SampleRatio  float64 // 根span采样比例，0到1；有上游traceparent时沿用上游的采样决定
+}
+
+// Setup 按配置安装全局TracerProvider和W3C traceparent传播器，返回的函数在退出时刷新并关闭导出器
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	// 无论是否导出，都传播上游的traceparent
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	provider := newProvider(cfg.ServiceName, cfg.SampleRatio, sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// InstallExporter 使用同步导出安装全局TracerProvider，全部采样，用于测试（如tracetest.InMemoryExporter）
+func InstallExporter(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	provider := newProvider("fuxi-test", 1, sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	return provider
+}
+
+func newProvider(serviceName string, ratio float64, processor sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = "fuxi"
+	}
+	res := resource.NewSchemaless(semconv.ServiceName(serviceName))
+
+	return sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+}
+
+// End 记录错误（如有）并结束span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceParent 返回ctx中span的W3C traceparent头，没有有效span时为空
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
@@ -0,0 +1,181 @@
+package urlcheck
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// MaxLength 目标URL的最大字节数，与URLMapping.LongURL列的长度一致
+const MaxLength = 2048
+
+// DefaultSchemes 默认允许的scheme
+var DefaultSchemes = []string{"http", "https"}
+
+// Code 校验失败的错误码，随400响应返回给调用方
+type Code string
+
+const (
+	CodeEmpty       Code = "empty_url"
+	CodeTooLong     Code = "url_too_long"
+	CodeMalformed   Code = "malformed_url"
+	CodeRelative    Code = "relative_url"
+	CodeScheme      Code = "scheme_not_allowed"
+	CodeMissingHost Code = "missing_host"
+	CodeInvalidHost Code = "invalid_host"
+	CodeCredentials Code = "credentials_not_allowed"
+	CodeLoop        Code = "redirect_loop"
+)
+
+// Error 校验失败的原因
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// reject 返回带错误码的校验错误
+func reject(code Code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// profile 按UTS #46查找规则将国际化域名转换为punycode，并校验标签长度
+var profile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.VerifyDNSLength(true),
+)
+
+// defaultPorts 规范化时省略的默认端口
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Validator 校验并规范化短URL的目标地址
+type Validator struct {
+	schemes map[string]bool
+	hosts   map[string]bool // 本服务的短域名，指向它们的目标会形成重定向循环
+}
+
+// NewValidator 创建校验器，schemes为空时使用DefaultSchemes，hosts为本服务的短域名
+func NewValidator(schemes, hosts []string) (*Validator, error) {
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+
+	v := &Validator{
+		schemes: make(map[string]bool, len(schemes)),
+		hosts:   make(map[string]bool, len(hosts)),
+	}
+	for _, s := range schemes {
+		v.schemes[strings.ToLower(strings.TrimSpace(s))] = true
+	}
+	for _, h := range hosts {
+		host, err := NormalizeHost(stripPort(strings.TrimSpace(h)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid short domain %q: %w", h, err)
+		}
+		v.hosts[host] = true
+	}
+	return v, nil
+}
+
+// Normalize 校验目标URL并返回规范化后的形式，失败时返回*Error
+//
+// 规范化包括：scheme和主机名转为小写、国际化域名转为punycode、去掉主机名末尾的点和默认端口。
+// 路径、查询参数和片段保持原样。extraHosts为额外视为本服务的主机名（如请求的Host头）。
+func (v *Validator) Normalize(raw string, extraHosts ...string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", reject(CodeEmpty, "long_url is required")
+	}
+	if len(raw) > MaxLength {
+		return "", reject(CodeTooLong, "long_url exceeds %d bytes", MaxLength)
+	}
+	if strings.ContainsFunc(raw, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return "", reject(CodeMalformed, "long_url contains control characters")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", reject(CodeMalformed, "long_url is not a valid URL")
+	}
+	if u.Scheme == "" {
+		return "", reject(CodeRelative, "long_url must be an absolute URL")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !v.schemes[u.Scheme] {
+		return "", reject(CodeScheme, "scheme %q is not allowed", u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", reject(CodeMissingHost, "long_url must include a host")
+	}
+	// https://trusted.example@evil.example 常用于钓鱼
+	if u.User != nil {
+		return "", reject(CodeCredentials, "long_url must not contain credentials")
+	}
+
+	host, err := NormalizeHost(u.Hostname())
+	if err != nil {
+		return "", reject(CodeInvalidHost, "invalid host %q", u.Hostname())
+	}
+	if v.hosts[host] {
+		return "", reject(CodeLoop, "long_url points to this service")
+	}
+	for _, h := range extraHosts {
+		if own, err := NormalizeHost(stripPort(h)); err == nil && own == host {
+			return "", reject(CodeLoop, "long_url points to this service")
+		}
+	}
+
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", reject(CodeInvalidHost, "invalid port %q", port)
+		}
+		if defaultPorts[u.Scheme] == port {
+			port = ""
+		}
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	normalized := u.String()
+	if len(normalized) > MaxLength {
+		return "", reject(CodeTooLong, "long_url exceeds %d bytes after normalization", MaxLength)
+	}
+	return normalized, nil
+}
+
+// NormalizeHost 返回小写的ASCII主机名（国际化域名转为punycode，去掉末尾的点），IP地址保持原样
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", fmt.Errorf("empty host")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	return profile.ToASCII(host)
+}
+
+// stripPort 去掉host:port中的端口
+func stripPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
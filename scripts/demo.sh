@@ -35,6 +35,9 @@ echo ""
 
 # 启动API服务器（后台）
 echo "🚀 步骤5: 启动API服务器..."
+# 演示用的引导管理员Key，/api接口需要API Key
+export FUXI_ADMIN_KEY="${FUXI_ADMIN_KEY:-demo-admin-key}"
+AUTH="Authorization: Bearer $FUXI_ADMIN_KEY"
 go run cmd/api/main.go > /tmp/fuxi.log 2>&1 &
 API_PID=$!
 echo "✓ 服务器已启动 (PID: $API_PID)"
@@ -54,6 +57,7 @@ echo ""
 
 echo "6.2 创建短URL #1"
 RESPONSE1=$(curl -s -X POST http://localhost:8080/api/shorten \
+  -H "$AUTH" \
   -H "Content-Type: application/json" \
   -d '{"long_url":"https://github.com/golang/go"}')
 CODE1=$(echo $RESPONSE1 | python3 -c "import sys, json; print(json.load(sys.stdin)['short_code'])")
@@ -62,6 +66,7 @@ echo ""
 
 echo "6.3 创建短URL #2"
 RESPONSE2=$(curl -s -X POST http://localhost:8080/api/shorten \
+  -H "$AUTH" \
   -H "Content-Type: application/json" \
   -d '{"long_url":"https://www.example.com/very/long/url/for/testing"}')
 CODE2=$(echo $RESPONSE2 | python3 -c "import sys, json; print(json.load(sys.stdin)['short_code'])")
@@ -77,7 +82,7 @@ curl -I http://localhost:8080/$CODE1 2>&1 | grep -E "HTTP|Location"
 echo ""
 
 echo "6.6 查看统计信息"
-curl -s http://localhost:8080/api/stats | python3 -m json.tool
+curl -s -H "$AUTH" http://localhost:8080/api/stats | python3 -m json.tool
 echo ""
 
 # 批量创建测试
@@ -85,6 +90,7 @@ echo "📈 步骤7: 批量创建测试（50个）..."
 START_TIME=$(date +%s)
 for i in {1..50}; do
   curl -s -X POST http://localhost:8080/api/shorten \
+    -H "$AUTH" \
     -H "Content-Type: application/json" \
     -d "{\"long_url\":\"https://test.com/page$i\"}" > /dev/null
 done
@@ -95,7 +101,7 @@ echo ""
 
 # 最终统计
 echo "📊 步骤8: 最终统计..."
-curl -s http://localhost:8080/api/stats | python3 -m json.tool
+curl -s -H "$AUTH" http://localhost:8080/api/stats | python3 -m json.tool
 echo ""
 
 # 清理
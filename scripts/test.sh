@@ -3,6 +3,9 @@
 # 测试脚本
 
 API_URL="http://localhost:8080"
+# 管理员API Key（统计接口需要），默认使用启动服务时的引导管理员Key
+API_KEY="${API_KEY:-$FUXI_ADMIN_KEY}"
+AUTH="Authorization: Bearer $API_KEY"
 
 echo "=== Fuxi API 测试 ==="
 echo ""
@@ -15,6 +18,7 @@ echo ""
 # 2. 创建短URL
 echo "2. 创建短URL"
 SHORT_CODE=$(curl -s -X POST "$API_URL/api/shorten" \
+  -H "$AUTH" \
   -H "Content-Type: application/json" \
   -d '{"long_url":"https://www.example.com/very/long/url/test"}' | \
   python3 -c "import sys, json; print(json.load(sys.stdin)['short_code'])")
@@ -29,13 +33,14 @@ echo ""
 
 # 4. 获取统计信息
 echo "4. 统计信息"
-curl -s "$API_URL/api/stats" | python3 -m json.tool
+curl -s -H "$AUTH" "$API_URL/api/stats" | python3 -m json.tool
 echo ""
 
 # 5. 创建多个短URL
 echo "5. 批量创建测试"
 for i in {1..5}; do
   curl -s -X POST "$API_URL/api/shorten" \
+  -H "$AUTH" \
     -H "Content-Type: application/json" \
     -d "{\"long_url\":\"https://test.com/page$i\"}" | \
     python3 -c "import sys, json; r=json.load(sys.stdin); print(f\"  {i}. {r['short_code']} -> {r['long_url']}\")"
@@ -44,7 +49,7 @@ echo ""
 
 # 6. 最终统计
 echo "6. 最终统计"
-curl -s "$API_URL/api/stats" | python3 -m json.tool
+curl -s -H "$AUTH" "$API_URL/api/stats" | python3 -m json.tool
 echo ""
 
 echo "✓ 测试完成"
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fuxi/internal/auth"
+	"fuxi/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAPIKeys 测试API Key的签发、校验、吊销以及短URL的归属隔离
+func TestAPIKeys(t *testing.T) {
+	store, err := storage.NewLayeredStorage(filepath.Join(t.TempDir(), "auth.db"), 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+
+	alice, aliceRaw, err := store.CreateAPIKey("alice", false, 0, "")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	bob, bobRaw, _ := store.CreateAPIKey("bob", false, 0, "")
+	_, adminRaw, _ := store.CreateAPIKey("ops", true, 0, "")
+
+	t.Run("签发与校验", func(t *testing.T) {
+		if !strings.HasPrefix(aliceRaw, storage.APIKeyPrefix) || !strings.HasPrefix(aliceRaw, alice.Prefix) {
+			t.Errorf("raw key %q, prefix %q", aliceRaw, alice.Prefix)
+		}
+		if alice.KeyHash == aliceRaw || alice.KeyHash != storage.HashAPIKey(aliceRaw) {
+			t.Errorf("key stored as %q, want SHA-256 hash", alice.KeyHash)
+		}
+
+		key, err := store.AuthenticateAPIKey(aliceRaw)
+		if err != nil || key.ID != alice.ID || key.Admin {
+			t.Fatalf("AuthenticateAPIKey = %+v, %v", key, err)
+		}
+		for _, raw := range []string{"", "fx_nope", aliceRaw[:len(aliceRaw)-1]} {
+			if _, err := store.AuthenticateAPIKey(raw); !errors.Is(err, storage.ErrInvalidAPIKey) {
+				t.Errorf("AuthenticateAPIKey(%q) = %v, want ErrInvalidAPIKey", raw, err)
+			}
+		}
+	})
+
+	t.Run("归属隔离", func(t *testing.T) {
+		ctx := context.Background()
+		for _, code := range []string{"own001", "own002"} {
+			if err := store.SaveMapping(ctx, &storage.URLMapping{ShortCode: code, LongURL: "https://alice.example/" + code, OwnerID: alice.ID}); err != nil {
+				t.Fatalf("SaveMapping: %v", err)
+			}
+		}
+		store.SaveMapping(ctx, &storage.URLMapping{ShortCode: "own003", LongURL: "https://bob.example", OwnerID: bob.ID})
+
+		links, total, err := store.ListMappings(alice.ID, 10, 0)
+		if err != nil || total != 2 || len(links) != 2 || links[0].ShortCode != "own002" {
+			t.Fatalf("ListMappings = %v, %d, %v", links, total, err)
+		}
+		if links, _, _ := store.ListMappings(alice.ID, 1, 1); len(links) != 1 || links[0].ShortCode != "own001" {
+			t.Errorf("ListMappings page 2 = %v", links)
+		}
+
+		// 其他Key修改或删除时与不存在的短URL返回相同的错误
+		if err := store.UpdateOwned(bob.ID, "own001", "https://evil.example"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("UpdateOwned by bob = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteOwned(bob.ID, "own001"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("DeleteOwned by bob = %v, want ErrNotFound", err)
+		}
+		if longURL, _ := store.Get("own001"); longURL != "https://alice.example/own001" {
+			t.Errorf("Get after rejected update = %q", longURL)
+		}
+
+		if err := store.UpdateOwned(alice.ID, "own001", "https://alice.example/new"); err != nil {
+			t.Fatalf("UpdateOwned by alice: %v", err)
+		}
+		if longURL, _ := store.Get("own001"); longURL != "https://alice.example/new" {
+			t.Errorf("Get after update = %q, want new URL", longURL)
+		}
+		if err := store.DeleteOwned(alice.ID, "own002"); err != nil {
+			t.Fatalf("DeleteOwned by alice: %v", err)
+		}
+		if m, err := store.GetMapping("own003"); err != nil || m.OwnerID != bob.ID {
+			t.Errorf("GetMapping = %+v, %v", m, err)
+		}
+	})
+
+	t.Run("中间件", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		newRouter := func(a *auth.Authenticator) *gin.Engine {
+			r := gin.New()
+			api := r.Group("/api", a.Middleware())
+			api.GET("/whoami", func(c *gin.Context) {
+				c.String(http.StatusOK, auth.Key(c).Name)
+			})
+			api.GET("/admin", auth.RequireAdmin(), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+			return r
+		}
+		do := func(r *gin.Engine, path, authorization string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		r := newRouter(auth.NewAuthenticator(store, true, "bootstrap-secret"))
+		tests := []struct {
+			name          string
+			path          string
+			authorization string
+			status        int
+			body          string
+		}{
+			{"缺少Key", "/api/whoami", "", 401, ""},
+			{"非Bearer", "/api/whoami", "Basic " + aliceRaw, 401, ""},
+			{"无效Key", "/api/whoami", "Bearer fx_0000", 401, ""},
+			{"普通Key", "/api/whoami", "Bearer " + aliceRaw, 200, "alice"},
+			{"scheme不区分大小写", "/api/whoami", "bearer " + bobRaw, 200, "bob"},
+			{"普通Key访问管理接口", "/api/admin", "Bearer " + aliceRaw, 403, ""},
+			{"管理员Key", "/api/admin", "Bearer " + adminRaw, 204, ""},
+			{"引导管理员Key", "/api/admin", "Bearer bootstrap-secret", 204, ""},
+		}
+		for _, tt := range tests {
+			w := do(r, tt.path, tt.authorization)
+			if w.Code != tt.status {
+				t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+			}
+			if w.Code == 401 && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s: missing WWW-Authenticate", tt.name)
+			}
+		}
+
+		// 吊销后立即失效，重复吊销不报错
+		if err := store.RevokeAPIKey(alice.ID); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+		if err := store.RevokeAPIKey(alice.ID); err != nil {
+			t.Errorf("RevokeAPIKey again: %v", err)
+		}
+		if err := store.RevokeAPIKey(9999); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+			t.Errorf("RevokeAPIKey unknown = %v, want ErrAPIKeyNotFound", err)
+		}
+		if w := do(r, "/api/whoami", "Bearer "+aliceRaw); w.Code != 401 {
+			t.Errorf("revoked key: status = %d, want 401", w.Code)
+		}
+		keys, _ := store.ListAPIKeys()
+		if len(keys) != 3 || !keys[0].Revoked() || keys[1].Revoked() {
+			t.Errorf("ListAPIKeys = %+v", keys)
+		}
+
+		// 关闭认证时按引导管理员处理
+		open := newRouter(auth.NewAuthenticator(store, false, ""))
+		if w := do(open, "/api/admin", ""); w.Code != 204 {
+			t.Errorf("auth disabled: status = %d, want 204", w.Code)
+		}
+	})
+}
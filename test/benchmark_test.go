@@ -5,9 +5,14 @@ import (
 	"fuxi/internal/generator"
 	"fuxi/internal/preload"
 	"fuxi/internal/storage"
+	"math/rand"
 	"os"
 	"testing"
 	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // BenchmarkGenerate 测试短URL生成性能
@@ -73,6 +78,40 @@ func BenchmarkDBGet(b *testing.B) {
 	}
 }
 
+// BenchmarkLRUCacheParallel 测试不同分片数下的并发查询性能
+func BenchmarkLRUCacheParallel(b *testing.B) {
+	const size = 100000
+
+	keys := make([]string, size)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("c%05d", i)
+	}
+
+	for _, shards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cache := storage.NewShardedLRUCache(size, shards)
+			for i, key := range keys {
+				cache.Put(key, fmt.Sprintf("https://example.com/%d", i))
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					// 90%读，10%写
+					key := keys[(i*7919)%size]
+					if i%10 == 0 {
+						cache.Put(key, "https://example.com/updated")
+					} else {
+						cache.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
 // TestGenerationMethods 对比不同生成方法
 func TestGenerationMethods(t *testing.T) {
 	count := 10000
@@ -212,6 +251,90 @@ func TestCacheEffectiveness(t *testing.T) {
 			t.Logf("  缓存命中率: %.2f%%", stats.CacheHitRate*100)
 		})
 	}
+
+	t.Run("Zipf分布", func(t *testing.T) {
+		testZipfWorkloads(t)
+	})
+}
+
+// testZipfWorkloads 对比不同淘汰策略在Zipf分布和扫描流量下的命中率
+func testZipfWorkloads(t *testing.T) {
+	const (
+		dataSize  = 50000
+		cacheSize = 1000
+		queries   = 30000
+	)
+
+	dbPath := "/tmp/fuxi_test_zipf.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	// 直接批量写入数据库，避免预填充时污染缓存
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.AutoMigrate(&storage.URLMapping{})
+	mappings := make([]storage.URLMapping, dataSize)
+	for i := range mappings {
+		mappings[i] = storage.URLMapping{
+			ShortCode: fmt.Sprintf("z%06d", i),
+			LongURL:   fmt.Sprintf("https://example.com/%d", i),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+	db.CreateInBatches(mappings, 1000)
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	workloads := []struct {
+		name     string
+		scanRate int // 每10次请求中扫描请求的数量
+	}{
+		{"Zipf", 0},
+		{"Zipf+扫描", 5},
+	}
+
+	for _, wl := range workloads {
+		hitRates := make(map[string]float64)
+
+		for _, policy := range []string{storage.PolicyLRU, storage.PolicyTinyLFU, storage.PolicyARC} {
+			store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+				DBPath:      dbPath,
+				CacheSize:   cacheSize,
+				CachePolicy: policy,
+			})
+			if err != nil {
+				t.Fatalf("NewLayeredStorageWithConfig(%s): %v", policy, err)
+			}
+
+			// 热点访问服从Zipf分布，扫描请求从尾部开始顺序访问冷链接
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, dataSize-1)
+			scan := dataSize - 1
+			for i := 0; i < queries; i++ {
+				idx := int(zipf.Uint64())
+				if i%10 < wl.scanRate {
+					idx = scan
+					scan--
+				}
+				store.Get(fmt.Sprintf("z%06d", idx))
+			}
+
+			stats, _ := store.GetStats()
+			store.Close()
+			hitRates[policy] = stats.CacheHitRate
+			t.Logf("%s %-8s 缓存命中率: %.2f%%", wl.name, policy, stats.CacheHitRate*100)
+		}
+
+		if wl.scanRate > 0 {
+			for _, policy := range []string{storage.PolicyTinyLFU, storage.PolicyARC} {
+				if hitRates[policy] <= hitRates[storage.PolicyLRU] {
+					t.Errorf("%s: %s hit rate %.4f not better than lru %.4f",
+						wl.name, policy, hitRates[policy], hitRates[storage.PolicyLRU])
+				}
+			}
+		}
+	}
 }
 
 // TestPreloadPerformance 测试预加载性能
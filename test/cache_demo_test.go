@@ -1,11 +1,20 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"fuxi/internal/storage"
+	"fuxi/internal/storage/redistest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // TestCacheDemo 演示缓存效果
@@ -115,3 +124,672 @@ func TestCacheDemo(t *testing.T) {
 		t.Logf("\n性能提升: %.2fx", float64(coldTime)/float64(hotTime))
 	})
 }
+
+// TestCacheByteBudget 测试按字节预算淘汰
+func TestCacheByteBudget(t *testing.T) {
+	const maxBytes = 256 << 10
+
+	for _, policy := range []string{storage.PolicyLRU, storage.PolicyTinyLFU, storage.PolicyARC} {
+		t.Run(policy, func(t *testing.T) {
+			cache, err := storage.NewCache(policy, 0, maxBytes)
+			if err != nil {
+				t.Fatalf("NewCache: %v", err)
+			}
+
+			// 长URL从20字节到2KB不等
+			for i := 0; i < 5000; i++ {
+				key := fmt.Sprintf("c%05d", i)
+				cache.Get(key)
+				cache.Put(key, "https://example.com/"+strings.Repeat("x", (i*37)%2048))
+			}
+
+			stats := cache.Stats()
+			t.Logf("条目: %d, 字节: %d, 淘汰: %d", stats.Size, stats.Bytes, stats.Evictions)
+
+			if stats.Bytes > maxBytes {
+				t.Fatalf("bytes %d exceed budget %d", stats.Bytes, maxBytes)
+			}
+			if stats.Bytes < maxBytes/2 {
+				t.Fatalf("bytes %d far below budget %d", stats.Bytes, maxBytes)
+			}
+			if stats.Evictions == 0 {
+				t.Fatalf("expected evictions")
+			}
+
+			// 更新后的值超过分片上限时不缓存，旧值也不能再返回
+			cache.Put("grow01", "https://example.com/small")
+			if _, ok := cache.Get("grow01"); !ok {
+				t.Fatalf("small entry not cached")
+			}
+			cache.Put("grow01", "https://example.com/"+strings.Repeat("x", maxBytes))
+			if value, ok := cache.Get("grow01"); ok {
+				t.Fatalf("oversized update kept stale value %q", value)
+			}
+		})
+	}
+}
+
+// TestNegativeLookup 测试负缓存、布隆过滤器和短URL格式校验
+func TestNegativeLookup(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "negative.db")
+
+	store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:      dbPath,
+		CacheSize:   100,
+		NegativeTTL: time.Minute,
+		CodeLengths: []int{6},
+	})
+	if err != nil {
+		t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+	}
+	store.Save("abc123", "https://example.com/a")
+	store.Close()
+
+	// 重启后从数据库重建布隆过滤器
+	store, err = storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:      dbPath,
+		CacheSize:   100,
+		NegativeTTL: time.Minute,
+		BloomSize:   1 << 16,
+		CodeLengths: []int{6},
+	})
+	if err != nil {
+		t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+	}
+	defer store.Close()
+
+	if got, err := store.Get("abc123"); err != nil || got != "https://example.com/a" {
+		t.Fatalf("Get existing: %q, %v", got, err)
+	}
+
+	// 长度或字符集不合法
+	for _, code := range []string{"abc", "abc1234", "abc!23", "favicon.ico"} {
+		if _, err := store.Get(code); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Get(%q): got %v, want ErrNotFound", code, err)
+		}
+	}
+
+	// 布隆过滤器拦截从未发放的短URL
+	if _, err := store.Get("zzzzzz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Get unknown: got %v", err)
+	}
+
+	stats, _ := store.GetStats()
+	if stats.InvalidCodes != 4 || stats.NegativeHits != 1 {
+		t.Fatalf("invalid=%d negative=%d, want 4 and 1", stats.InvalidCodes, stats.NegativeHits)
+	}
+
+	// 新创建的短URL不再被拦截
+	if err := store.Save("zzzzzz", "https://example.com/z"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, err := store.Get("zzzzzz"); err != nil || got != "https://example.com/z" {
+		t.Fatalf("Get after save: %q, %v", got, err)
+	}
+}
+
+// TestNegativeCache 测试未找到结果的短期缓存
+func TestNegativeCache(t *testing.T) {
+	store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:      filepath.Join(t.TempDir(), "negative.db"),
+		CacheSize:   100,
+		NegativeTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+	}
+	defer store.Close()
+
+	// 第一次查库，第二次由负缓存拦截
+	store.Get("missing")
+	store.Get("missing")
+
+	stats, _ := store.GetStats()
+	if stats.NegativeHits != 1 {
+		t.Fatalf("negative hits = %d, want 1", stats.NegativeHits)
+	}
+
+	store.Save("missing", "https://example.com/m")
+	if _, err := store.Get("missing"); err != nil {
+		t.Fatalf("Get after save: %v", err)
+	}
+}
+
+// TestCachedExpiry 测试缓存中的短URL过期后不再返回，并由负缓存拦截
+func TestCachedExpiry(t *testing.T) {
+	store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:      filepath.Join(t.TempDir(), "expiry.db"),
+		CacheSize:   100,
+		NegativeTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+	}
+	defer store.Close()
+
+	err = store.SaveMapping(context.Background(), &storage.URLMapping{
+		ShortCode: "soon01",
+		LongURL:   "https://example.com/soon",
+		ExpiresAt: time.Now().Add(200 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("SaveMapping: %v", err)
+	}
+	if got, err := store.Get("soon01"); err != nil || got != "https://example.com/soon" {
+		t.Fatalf("Get before expiry: %q, %v", got, err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if got, err := store.Get("soon01"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Get after expiry: %q, %v", got, err)
+		}
+	}
+	if stats, _ := store.GetStats(); stats.NegativeHits != 1 || stats.CacheSize != 0 {
+		t.Fatalf("negative hits=%d cache size=%d, want 1 and 0", stats.NegativeHits, stats.CacheSize)
+	}
+}
+
+// TestThunderingHerd 测试缓存未命中时并发查询同一短URL只访问一次数据库
+func TestThunderingHerd(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "herd.db")
+
+	store, _ := storage.NewLayeredStorage(dbPath, 100)
+	store.Save("viral1", "https://example.com/viral")
+	store.Save("viral2", "https://example.com/viral2")
+	store.Close()
+
+	// 重启后缓存为空
+	store, err := storage.NewLayeredStorage(dbPath, 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+
+	// 统计查询次数，并放慢查询使并发请求重叠
+	var queries atomic.Int64
+	store.DB().Callback().Query().Before("gorm:query").Register("test:count", func(db *gorm.DB) {
+		queries.Add(1)
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	const concurrency = 200
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var failures atomic.Int64
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if got, err := store.Get("viral1"); err != nil || got != "https://example.com/viral" {
+				failures.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if failures.Load() > 0 {
+		t.Fatalf("%d requests failed", failures.Load())
+	}
+	n := queries.Load()
+	if n != 1 {
+		t.Fatalf("database queries = %d, want 1", n)
+	}
+
+	stats, _ := store.GetStats()
+	t.Logf("并发请求: %d, 数据库查询: %d, 合并: %d", concurrency, n, stats.CoalescedLookups)
+
+	// 发起查询的请求中途取消，不影响合并到同一查询的其他请求
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := store.GetContext(ctx, "viral2")
+		leader <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := store.GetContext(context.Background(), "viral2"); err != nil || got != "https://example.com/viral2" {
+				failures.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := <-leader; err != nil {
+		t.Errorf("canceled leader: %v", err)
+	}
+	if failures.Load() > 0 {
+		t.Errorf("%d coalesced requests failed after the leader was canceled", failures.Load())
+	}
+}
+
+// TestCacheWarmup 测试热点快照写入和重启后的缓存预热
+func TestCacheWarmup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "warmup.db")
+	snapshotPath := filepath.Join(dir, "hotlinks.json")
+
+	open := func(snapshot string) *storage.LayeredStorage {
+		store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+			DBPath:       dbPath,
+			CacheSize:    100,
+			SnapshotPath: snapshot,
+			WarmupSize:   5,
+		})
+		if err != nil {
+			t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+		}
+		return store
+	}
+
+	// 没有快照时按访问量预热
+	store := open("")
+	for i := 0; i < 20; i++ {
+		store.Save(fmt.Sprintf("code%02d", i), fmt.Sprintf("https://example.com/%d", i))
+		for j := 0; j < i; j++ {
+			store.IncrementAccess(fmt.Sprintf("code%02d", i))
+		}
+	}
+	store.Close()
+
+	store = open("")
+	stats, _ := store.GetStats()
+	if stats.WarmedEntries != 5 {
+		t.Fatalf("warmed from DB: %d, want 5", stats.WarmedEntries)
+	}
+	store.Get("code19")
+	if stats, _ := store.GetStats(); stats.CacheHitRate != 1 {
+		t.Fatalf("most accessed code not warmed, hit rate %.2f", stats.CacheHitRate)
+	}
+	store.Close()
+
+	// 关闭时写入快照，重启后按快照预热（首次访问未命中，不计入命中次数）
+	store = open(snapshotPath)
+	for i := 0; i < 3; i++ {
+		for j := 0; j <= i+1; j++ {
+			store.Get(fmt.Sprintf("code%02d", i))
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	snapshot, err := storage.ReadSnapshot(snapshotPath)
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	if len(snapshot.Entries) != 3 || snapshot.Entries[0].Code != "code02" {
+		t.Fatalf("snapshot entries: %+v", snapshot.Entries)
+	}
+
+	store = open(snapshotPath)
+	defer store.Close()
+	stats, _ = store.GetStats()
+	if stats.WarmedEntries != 3 {
+		t.Fatalf("warmed from snapshot: %d, want 3", stats.WarmedEntries)
+	}
+	for i := 0; i < 3; i++ {
+		store.Get(fmt.Sprintf("code%02d", i))
+	}
+	if stats, _ := store.GetStats(); stats.CacheHitRate != 1 {
+		t.Fatalf("snapshot codes not warmed, hit rate %.2f", stats.CacheHitRate)
+	}
+}
+
+// TestRedisL2Cache 测试Redis二级缓存的读穿透、写穿透和有效期
+func TestRedisL2Cache(t *testing.T) {
+	server, err := redistest.NewServerWithPassword("secret")
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	dir := t.TempDir()
+	open := func(name string) *storage.LayeredStorage {
+		store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+			DBPath:    filepath.Join(dir, name),
+			CacheSize: 100,
+			Redis: storage.RedisOptions{
+				Addr:      server.Addr(),
+				Password:  "secret",
+				DB:        1,
+				KeyPrefix: "fuxi:",
+			},
+			L2MaxTTL: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+		}
+		return store
+	}
+
+	// 写穿透：保存时同时写入二级缓存，有效期受L2MaxTTL限制
+	a := open("a.db")
+	defer a.Close()
+	if err := a.Save("abc123", "https://example.com/a"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, ok := server.Get("fuxi:abc123"); !ok || !strings.Contains(got, `"url":"https://example.com/a"`) {
+		t.Fatalf("L2 after Save: %q, %v", got, ok)
+	}
+	if ttl := server.TTL("fuxi:abc123"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("L2 ttl = %v, want about 1h", ttl)
+	}
+
+	// 读穿透：另一个实例的数据库中没有该记录，从二级缓存读取并回填本地缓存
+	b := open("b.db")
+	defer b.Close()
+	for i := 0; i < 2; i++ {
+		if got, err := b.Get("abc123"); err != nil || got != "https://example.com/a" {
+			t.Fatalf("Get via L2: %q, %v", got, err)
+		}
+	}
+	stats, _ := b.GetStats()
+	if stats.L2Hits != 1 || stats.CacheHitRate != 0.5 {
+		t.Fatalf("l2 hits=%d hit rate=%.2f, want 1 and 0.5", stats.L2Hits, stats.CacheHitRate)
+	}
+
+	// 修改后，修改前读到旧记录的查询不能把旧值回填到二级缓存：
+	// 用数据库中仍是旧记录的实例c模拟与修改并发、先于修改完成查询的请求
+	if err := a.Update("abc123", "https://example.com/a2"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	c := open("c.db")
+	defer c.Close()
+	c.DB().Create(&storage.URLMapping{ShortCode: "abc123", LongURL: "https://example.com/a", ExpiresAt: time.Now().Add(time.Hour)})
+	c.Get("abc123")
+	if got, _ := server.Get("fuxi:abc123"); strings.Contains(got, `"url":"https://example.com/a"`) {
+		t.Fatalf("stale value written back to L2 after Update")
+	}
+	if got, err := a.Get("abc123"); err != nil || got != "https://example.com/a2" {
+		t.Fatalf("Get after Update: %q, %v", got, err)
+	}
+
+	// 二级缓存未命中时查数据库并回填
+	if err := a.DB().Create(&storage.URLMapping{
+		ShortCode: "old123",
+		LongURL:   "https://example.com/old",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	}).Error; err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if got, err := a.Get("old123"); err != nil || got != "https://example.com/old" {
+		t.Fatalf("Get from DB: %q, %v", got, err)
+	}
+	if ttl := server.TTL("fuxi:old123"); ttl <= 9*time.Minute || ttl > 10*time.Minute {
+		t.Fatalf("L2 ttl = %v, want aligned with ExpiresAt", ttl)
+	}
+
+	// Redis不可用时回退到数据库
+	server.Close()
+	if err := a.Save("down12", "https://example.com/down"); err != nil {
+		t.Fatalf("Save with L2 down: %v", err)
+	}
+	a.DB().Create(&storage.URLMapping{
+		ShortCode: "new123",
+		LongURL:   "https://example.com/new",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if got, err := a.Get("new123"); err != nil || got != "https://example.com/new" {
+		t.Fatalf("Get with L2 down: %q, %v", got, err)
+	}
+	if stats, _ := a.GetStats(); stats.L2Errors < 2 {
+		t.Fatalf("l2 errors = %d, want at least 2", stats.L2Errors)
+	}
+}
+
+// TestInvalidationBus 测试共享数据库的多个实例之间的缓存失效广播
+func TestInvalidationBus(t *testing.T) {
+	dir := t.TempDir()
+	fileBus := func() storage.InvalidationBus {
+		bus, err := storage.NewFileBus(filepath.Join(dir, "invalidation.log"), time.Hour, 0)
+		if err != nil {
+			t.Fatalf("NewFileBus: %v", err)
+		}
+		return bus
+	}
+	memoryBus := storage.NewMemoryBus()
+
+	for _, tc := range []struct {
+		name string
+		bus  func() storage.InvalidationBus
+	}{
+		{"memory", func() storage.InvalidationBus { return memoryBus }},
+		{"file", fileBus},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dbPath := filepath.Join(dir, tc.name+".db")
+			busA, busB := tc.bus(), tc.bus()
+			defer busA.Close()
+			defer busB.Close()
+
+			// poll 让文件广播立即读取新消息
+			poll := func() {
+				for _, bus := range []storage.InvalidationBus{busA, busB} {
+					if fb, ok := bus.(*storage.FileBus); ok {
+						if err := fb.Poll(); err != nil {
+							t.Fatalf("Poll: %v", err)
+						}
+					}
+				}
+			}
+
+			open := func(bus storage.InvalidationBus) *storage.LayeredStorage {
+				store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+					DBPath:      dbPath,
+					CacheSize:   100,
+					NegativeTTL: time.Minute,
+					BloomSize:   1 << 16,
+					Bus:         bus,
+				})
+				if err != nil {
+					t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+				}
+				return store
+			}
+			a, b := open(busA), open(busB)
+			defer a.Close()
+			defer b.Close()
+
+			// 实例A新建，实例B的布隆过滤器和负缓存不再拦截
+			if _, err := b.Get("abc123"); !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("Get before create: %v", err)
+			}
+			a.Save("abc123", "https://example.com/v1")
+			poll()
+			if got, err := b.Get("abc123"); err != nil || got != "https://example.com/v1" {
+				t.Fatalf("Get after create: %q, %v", got, err)
+			}
+
+			// 实例A修改，实例B淘汰缓存后读到新地址
+			if err := a.Update("abc123", "https://example.com/v2"); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			poll()
+			if got, err := b.Get("abc123"); err != nil || got != "https://example.com/v2" {
+				t.Fatalf("Get after update: %q, %v", got, err)
+			}
+
+			// 实例A删除，实例B不再返回旧地址
+			if err := a.Delete("abc123"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			poll()
+			if _, err := b.Get("abc123"); !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("Get after delete: %v", err)
+			}
+			if err := a.Delete("abc123"); !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("Delete twice: %v", err)
+			}
+
+			if stats, _ := b.GetStats(); stats.Invalidations == 0 {
+				t.Fatalf("no invalidations received")
+			}
+		})
+	}
+}
+
+// TestFileBusRotation 测试广播文件轮转不丢消息，漏掉消息时分发OpReset
+func TestFileBusRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalidation.log")
+	writer, err := storage.NewFileBus(path, time.Hour, 64)
+	if err != nil {
+		t.Fatalf("NewFileBus: %v", err)
+	}
+	defer writer.Close()
+	reader, err := storage.NewFileBus(path, time.Hour, 64)
+	if err != nil {
+		t.Fatalf("NewFileBus: %v", err)
+	}
+	defer reader.Close()
+
+	var got []string
+	reader.Subscribe(func(msg storage.Invalidation) {
+		got = append(got, string(msg.Op)+" "+msg.Code)
+	})
+	publish := func(from, to int) []string {
+		var want []string
+		for i := from; i < to; i++ {
+			code := fmt.Sprintf("code%02d", i)
+			if err := writer.Publish(storage.Invalidation{Op: storage.OpUpdate, Code: code}); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+			want = append(want, "update "+code)
+		}
+		return want
+	}
+	poll := func() {
+		if err := reader.Poll(); err != nil {
+			t.Fatalf("Poll: %v", err)
+		}
+	}
+
+	// 每条消息14字节，约4条轮转一次；两次读取之间最多轮转一次时不丢消息
+	var want []string
+	for i := 0; i < 30; i += 3 {
+		want = append(want, publish(i, i+3)...)
+		poll()
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("received %v, want %v", got, want)
+	}
+	if info, _ := os.Stat(path); info.Size() > 64+14 {
+		t.Fatalf("invalidation file not rotated: %d bytes", info.Size())
+	}
+
+	// 两次读取之间轮转多次，无法得知中间的消息，先分发reset再分发新文件中的消息
+	got = nil
+	publish(30, 50)
+	poll()
+	if len(got) == 0 || got[0] != "reset " || len(got) == 21 {
+		t.Fatalf("after missed rotations received %v, want reset first", got)
+	}
+
+	// 截断后重新增长：写入方换成新一代文件，读取方分发reset和截断后的全部消息
+	got = nil
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	poll()
+	if len(got) != 0 {
+		t.Fatalf("received %v before the truncated file was replaced", got)
+	}
+	want = append([]string{"reset "}, publish(50, 53)...)
+	poll()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("after truncation received %v, want %v", got, want)
+	}
+}
+
+// TestInvalidationResetBloom 测试收到OpReset后重建布隆过滤器，漏掉的新建不再返回404
+func TestInvalidationResetBloom(t *testing.T) {
+	bus := storage.NewMemoryBus()
+	store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:      filepath.Join(t.TempDir(), "reset.db"),
+		CacheSize:   100,
+		NegativeTTL: time.Minute,
+		BloomSize:   1 << 16,
+		Bus:         bus,
+	})
+	if err != nil {
+		t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+	}
+	defer store.Close()
+
+	// 直接写数据库，相当于漏掉了其他实例的新建消息
+	store.DB().Create(&storage.URLMapping{ShortCode: "abc123", LongURL: "https://example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	if _, err := store.Get("abc123"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Get before reset: %v", err)
+	}
+
+	if err := bus.Publish(storage.Invalidation{Op: storage.OpReset}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got, err := store.Get("abc123"); err != nil || got != "https://example.com" {
+		t.Fatalf("Get after reset: %q, %v", got, err)
+	}
+
+	// 重建后本实例新建的短URL仍能被找到
+	if err := store.Save("def456", "https://example.org"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, err := store.Get("def456"); err != nil || got != "https://example.org" {
+		t.Fatalf("Get after save: %q, %v", got, err)
+	}
+}
+
+// TestCacheMetrics 测试写入、淘汰、滑动窗口命中率和各层耗时统计
+func TestCacheMetrics(t *testing.T) {
+	for _, policy := range []string{storage.PolicyLRU, storage.PolicyTinyLFU, storage.PolicyARC} {
+		cache, err := storage.NewCache(policy, 10, 0)
+		if err != nil {
+			t.Fatalf("NewCache(%s): %v", policy, err)
+		}
+		for i := 0; i < 20; i++ {
+			cache.Put(fmt.Sprintf("k%d", i), "v")
+		}
+		cache.Put("k19", "v2") // 更新不计入写入数
+		cache.Get("k19")
+		cache.Get("missing")
+
+		stats := cache.Stats()
+		if stats.Insertions != 20 || stats.Evictions != int64(20-stats.Size) {
+			t.Fatalf("%s: insertions=%d evictions=%d size=%d", policy, stats.Insertions, stats.Evictions, stats.Size)
+		}
+		if stats.HitRate1m != 0.5 || stats.HitRate15m != 0.5 || cache.HitRateOver(5*time.Minute) != 0.5 {
+			t.Fatalf("%s: window hit rates %.2f/%.2f", policy, stats.HitRate1m, stats.HitRate15m)
+		}
+
+		// 清空条目不重置计数
+		cache.Clear()
+		if stats := cache.Stats(); stats.Size != 0 || stats.Hits != 1 || stats.Insertions != 20 {
+			t.Fatalf("%s: after Clear: %+v", policy, stats)
+		}
+	}
+
+	store, err := storage.NewLayeredStorage(filepath.Join(t.TempDir(), "metrics.db"), 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+
+	store.DB().Create(&storage.URLMapping{ShortCode: "abc123", LongURL: "https://example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	store.Get("abc123") // 未命中，查数据库
+	store.Get("abc123") // 命中
+	store.Get("zzzzzz") // 未命中，数据库中不存在
+
+	stats, _ := store.GetStats()
+	if stats.CacheHitLatency.Count != 1 || stats.FallbackLatency.Count != 2 || stats.DBLatency.Count != 2 {
+		t.Fatalf("latency counts: hit=%d fallback=%d db=%d",
+			stats.CacheHitLatency.Count, stats.FallbackLatency.Count, stats.DBLatency.Count)
+	}
+	if stats.FallbackLatency.Mean() <= 0 || stats.CacheInsertions != 1 || stats.CacheMisses != 2 {
+		t.Fatalf("fallback=%v insertions=%d misses=%d", stats.FallbackLatency.Mean(), stats.CacheInsertions, stats.CacheMisses)
+	}
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fuxi/internal/logging"
+	"fuxi/internal/preload"
+	"fuxi/internal/storage"
+	"fuxi/internal/storage/redistest"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logLines 解析JSON日志，返回指定消息的记录
+func logLines(t *testing.T, buf *bytes.Buffer, msg string) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid JSON log line %q: %v", line, err)
+		}
+		if rec["msg"] == msg {
+			lines = append(lines, rec)
+		}
+	}
+	return lines
+}
+
+// TestStructuredLogging 测试请求ID的生成、回显以及在存储层和预加载日志中的传播
+func TestStructuredLogging(t *testing.T) {
+	for _, cfg := range []logging.Config{{Level: "verbose"}, {Format: "xml"}} {
+		if _, err := logging.New(io.Discard, cfg); err == nil {
+			t.Errorf("New(%+v) should fail", cfg)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "debug", Format: logging.FormatJSON})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	old := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(old)
+
+	// 二级缓存在启动后不可用，保存时的写入失败会记录到请求的日志中
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+		DBPath:    filepath.Join(t.TempDir(), "logging.db"),
+		CacheSize: 100,
+		Redis:     storage.RedisOptions{Addr: server.Addr()},
+	})
+	if err != nil {
+		t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+	}
+	defer store.Close()
+	server.Close()
+
+	// 空号池，取号时加载失败
+	urlFile, offsetFile := writePool(t, 0)
+	list := preload.NewLinkedURL(preload.NewFileLoader(urlFile, offsetFile), 1, 10)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logging.Middleware(), logging.Recovery())
+	r.POST("/save/:code", func(c *gin.Context) {
+		if err := store.SaveContext(c.Request.Context(), c.Param("code"), "https://example.com"); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	r.GET("/acquire", func(c *gin.Context) {
+		if _, err := list.AcquireContext(c.Request.Context()); err != nil {
+			c.Error(err)
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	serve := func(method, path, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if requestID != "" {
+			req.Header.Set(logging.HeaderRequestID, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("上游请求ID", func(t *testing.T) {
+		buf.Reset()
+		w := serve(http.MethodPost, "/save/log001", "req-123")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		if got := w.Header().Get(logging.HeaderRequestID); got != "req-123" {
+			t.Errorf("X-Request-ID = %q, want req-123", got)
+		}
+
+		warns := logLines(t, &buf, "l2 cache set failed")
+		if len(warns) != 1 || warns[0]["request_id"] != "req-123" || warns[0]["short_code"] != "log001" {
+			t.Errorf("storage log = %v, want one line with request_id req-123", warns)
+		}
+		access := logLines(t, &buf, "http request")
+		if len(access) != 1 {
+			t.Fatalf("access log lines = %d, want 1", len(access))
+		}
+		if access[0]["request_id"] != "req-123" || access[0]["route"] != "/save/:code" || access[0]["status"] != float64(200) {
+			t.Errorf("access log = %v", access[0])
+		}
+	})
+
+	t.Run("生成请求ID", func(t *testing.T) {
+		buf.Reset()
+		w := serve(http.MethodGet, "/acquire", "bad id\n")
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want 503", w.Code)
+		}
+		id := w.Header().Get(logging.HeaderRequestID)
+		if len(id) != 16 || id == "bad id\n" {
+			t.Fatalf("X-Request-ID = %q, want generated 16-char ID", id)
+		}
+
+		failures := logLines(t, &buf, "preload refill failed")
+		if len(failures) == 0 || failures[0]["request_id"] != id || failures[0]["pool"] != preload.DefaultPoolName {
+			t.Errorf("preload log = %v, want request_id %s", failures, id)
+		}
+		access := logLines(t, &buf, "http request")
+		if len(access) != 1 || access[0]["level"] != "ERROR" || !strings.Contains(access[0]["error"].(string), "exhausted") {
+			t.Errorf("access log = %v, want ERROR with error", access)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		buf.Reset()
+		w := serve(http.MethodGet, "/panic", "")
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", w.Code)
+		}
+		panics := logLines(t, &buf, "panic recovered")
+		if len(panics) != 1 || panics[0]["panic"] != "boom" || panics[0]["request_id"] != w.Header().Get(logging.HeaderRequestID) {
+			t.Errorf("panic log = %v", panics)
+		}
+		if access := logLines(t, &buf, "http request"); len(access) != 1 || access[0]["level"] != "ERROR" {
+			t.Errorf("access log = %v, want ERROR", access)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"bytes"
+	"fuxi/internal/metrics"
+	"fuxi/internal/storage"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMetricsText 测试Prometheus文本格式输出
+func TestMetricsText(t *testing.T) {
+	requests := metrics.NewCounterVec("test_requests_total", "Requests.\nSecond line.", "route", "status")
+	requests.With("/:code", "302").Add(2)
+	requests.With(`/a"b`, "404").Inc()
+
+	depth := metrics.NewGauge("test_depth", "Depth.")
+	depth.Set(42)
+
+	latency := metrics.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.With("/api").Observe(0.05)
+	latency.With("/api").Observe(0.5)
+	latency.With("/api").Observe(3)
+
+	var buf bytes.Buffer
+	if err := metrics.Default.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# HELP test_requests_total Requests.\\nSecond line.\n",
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{route="/:code",status="302"} 2` + "\n",
+		`test_requests_total{route="/a\"b",status="404"} 1` + "\n",
+		"# TYPE test_depth gauge\ntest_depth 42\n",
+		`test_latency_seconds_bucket{route="/api",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{route="/api",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{route="/api",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{route="/api"} 3.55` + "\n",
+		`test_latency_seconds_count{route="/api"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+
+	// 存储层直接写入缓存和数据库指标
+	store, err := storage.NewLayeredStorage(filepath.Join(t.TempDir(), "metrics.db"), 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+	store.Save("abc123", "https://example.com")
+	store.Get("abc123")
+
+	buf.Reset()
+	metrics.Default.WriteText(&buf)
+	for _, want := range []string{
+		`fuxi_cache_requests_total{result="hit"}`,
+		`fuxi_db_query_duration_seconds_count{op="save"}`,
+		"fuxi_cache_evictions_total",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
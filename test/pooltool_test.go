@@ -0,0 +1,194 @@
+package test
+
+import (
+	"fuxi/internal/preload"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCodes 把短URL依次写入号池文件，consumed为已消费的短URL数量
+func writeCodes(t *testing.T, dir, name string, codes []string, consumed int) preload.PoolFile {
+	t.Helper()
+	pool := preload.PoolFile{
+		URLFile:    filepath.Join(dir, name+".dat"),
+		OffsetFile: filepath.Join(dir, name+".offset"),
+		Length:     len(codes[0]),
+	}
+	if err := os.WriteFile(pool.URLFile, []byte(strings.Join(codes, "")), 0644); err != nil {
+		t.Fatalf("write pool: %v", err)
+	}
+	if err := os.WriteFile(pool.OffsetFile, []byte(strconv.Itoa(consumed*pool.Length)), 0644); err != nil {
+		t.Fatalf("write offset: %v", err)
+	}
+	return pool
+}
+
+// readCodes 读取号池文件中的全部短URL
+func readCodes(t *testing.T, path string, length int) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read pool: %v", err)
+	}
+	var codes []string
+	for i := 0; i+length <= len(data); i += length {
+		codes = append(codes, string(data[i:i+length]))
+	}
+	return codes
+}
+
+// TestPoolStatusVerify 测试号池状态统计和完整性检查
+func TestPoolStatusVerify(t *testing.T) {
+	dir := t.TempDir()
+	pool := writeCodes(t, dir, "a", []string{"aaa111", "bbb222", "ccc333", "ddd444"}, 1)
+
+	st, err := pool.Status()
+	if err != nil || st.Total != 4 || st.Consumed != 1 || st.Remaining != 3 || !st.Aligned(pool.Length) {
+		t.Errorf("Status = %+v, %v", st, err)
+	}
+	report, err := pool.Verify()
+	if err != nil || !report.OK() || report.Codes != 4 {
+		t.Errorf("Verify clean pool = %+v, %v", report, err)
+	}
+
+	// 重复、非法字符、末尾残余和未对齐的偏移量
+	bad := writeCodes(t, dir, "bad", []string{"aaa111", "bb!222", "aaa111", "ccc333"}, 0)
+	f, _ := os.OpenFile(bad.URLFile, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("xy")
+	f.Close()
+	os.WriteFile(bad.OffsetFile, []byte("7"), 0644)
+
+	report, err = bad.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK() || report.Codes != 4 || report.Duplicates != 1 || report.Invalid != 1 || report.Count() != 4 {
+		t.Errorf("Verify = %+v, want 1 duplicate, 1 invalid, 2 alignment problems", report)
+	}
+	if st, _ := bad.Status(); st.Aligned(bad.Length) {
+		t.Error("misaligned offset reported as aligned")
+	}
+}
+
+// TestPoolRewindSkip 测试回退和跳过偏移量
+func TestPoolRewindSkip(t *testing.T) {
+	pool := writeCodes(t, t.TempDir(), "a", []string{"aaa111", "bbb222", "ccc333", "ddd444", "eee555"}, 2)
+
+	if from, to, err := pool.Skip(2); err != nil || from != 12 || to != 24 {
+		t.Errorf("Skip(2) = %d, %d, %v, want 12, 24", from, to, err)
+	}
+	// 最多跳到文件末尾
+	if _, to, err := pool.Skip(10); err != nil || to != 30 {
+		t.Errorf("Skip(10) = %d, %v, want 30", to, err)
+	}
+	if _, _, err := pool.Skip(0); err == nil {
+		t.Error("Skip(0) succeeded")
+	}
+
+	if from, to, err := pool.Rewind(1, -1); err != nil || from != 30 || to != 24 {
+		t.Errorf("Rewind(1) = %d, %d, %v, want 30, 24", from, to, err)
+	}
+	if _, to, err := pool.Rewind(0, 1); err != nil || to != 6 {
+		t.Errorf("Rewind to 1 = %d, %v, want 6", to, err)
+	}
+	if _, _, err := pool.Rewind(0, 3); err == nil {
+		t.Error("Rewind ahead of the current offset succeeded")
+	}
+	if _, to, err := pool.Rewind(10, -1); err != nil || to != 0 {
+		t.Errorf("Rewind(10) = %d, %v, want 0", to, err)
+	}
+	if _, _, err := pool.Rewind(0, -1); err == nil {
+		t.Error("Rewind without -n or -to succeeded")
+	}
+	if offset, _ := preload.ReadOffset(pool.OffsetFile); offset != 0 {
+		t.Errorf("offset = %d, want 0", offset)
+	}
+}
+
+// TestPoolMerge 测试合并号池：跳过任一输入已消费的短URL，合并后输入被标记为已消费
+func TestPoolMerge(t *testing.T) {
+	dir := t.TempDir()
+	// a已发放aaa111和bbb222；b未消费部分中的bbb222可能已经由a发放，ddd444在两个输入中重复
+	a := writeCodes(t, dir, "a", []string{"aaa111", "bbb222", "ccc333", "ddd444"}, 2)
+	b := writeCodes(t, dir, "b", []string{"eee555", "bbb222", "ddd444", "fff666"}, 1)
+	out := filepath.Join(dir, "merged.dat")
+
+	result, err := preload.Merge([]preload.PoolFile{a, b}, out, out+".offset", false)
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if result.Read != 5 || result.Written != 3 || result.Duplicates != 1 || result.Issued != 1 {
+		t.Errorf("Merge = %+v, want read 5, written 3, 1 duplicate, 1 issued", result)
+	}
+	if got := strings.Join(readCodes(t, out, 6), ","); got != "ccc333,ddd444,fff666" {
+		t.Errorf("merged pool = %s", got)
+	}
+	if offset, _ := preload.ReadOffset(out + ".offset"); offset != 0 {
+		t.Errorf("output offset = %d, want 0", offset)
+	}
+	// 输入已全部标记为已消费，运行中的服务不会再从输入发放这些短URL
+	for _, in := range []preload.PoolFile{a, b} {
+		if st, _ := in.Status(); st.Remaining != 0 {
+			t.Errorf("%s: remaining = %d after merge, want 0", in.URLFile, st.Remaining)
+		}
+	}
+
+	// 覆盖正在使用的输出号池：等服务释放输出偏移量文件的锁后，再替换文件并归零偏移量
+	d := writeCodes(t, dir, "d", []string{"iii999", "jjj000"}, 0)
+	if err := os.WriteFile(out+".offset", []byte("6"), 0644); err != nil {
+		t.Fatalf("write output offset: %v", err)
+	}
+	locked, release := make(chan struct{}), make(chan struct{})
+	go preload.UpdateOffset(out+".offset", func(offset int64) (int64, error) {
+		close(locked)
+		<-release
+		return offset, nil
+	})
+	<-locked
+	done := make(chan error, 1)
+	go func() {
+		_, err := preload.Merge([]preload.PoolFile{d}, out, out+".offset", false)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Merge finished while the output offset was locked: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got := strings.Join(readCodes(t, out, 6), ","); got != "ccc333,ddd444,fff666" {
+		t.Errorf("output replaced while its offset was locked: %s", got)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if offset, _ := preload.ReadOffset(out + ".offset"); offset != 0 {
+		t.Errorf("output offset = %d after re-merge, want 0", offset)
+	}
+	if got := strings.Join(readCodes(t, out, 6), ","); got != "iii999,jjj000" {
+		t.Errorf("re-merged pool = %s", got)
+	}
+
+	// 输出与输入相同的文件时拒绝，输入保持不变
+	c := writeCodes(t, dir, "c", []string{"ggg777", "hhh888"}, 0)
+	if _, err := preload.Merge([]preload.PoolFile{c}, c.URLFile, c.URLFile+".new", false); err == nil {
+		t.Error("Merge into an input succeeded")
+	}
+	if got := readCodes(t, c.URLFile, 6); len(got) != 2 {
+		t.Errorf("input changed after rejected merge: %v", got)
+	}
+
+	// 没有偏移量文件的输入需要force
+	raw := preload.PoolFile{URLFile: c.URLFile, Length: 6}
+	if _, err := preload.Merge([]preload.PoolFile{raw}, filepath.Join(dir, "raw.dat"), filepath.Join(dir, "raw.offset"), false); err == nil {
+		t.Error("Merge of input without offset file succeeded without force")
+	}
+	result, err = preload.Merge([]preload.PoolFile{raw}, filepath.Join(dir, "raw.dat"), filepath.Join(dir, "raw.offset"), true)
+	if err != nil || result.Written != 2 {
+		t.Errorf("forced Merge = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,320 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fuxi/internal/generator"
+	"fuxi/internal/preload"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writePool 生成指定数量的短URL并写入测试池文件
+func writePool(t *testing.T, count int) (string, string) {
+	t.Helper()
+	return writePoolWithLength(t, count, generator.DefaultLength)
+}
+
+// writePoolWithLength 生成指定长度的短URL并写入测试池文件
+func writePoolWithLength(t *testing.T, count, length int) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	urlFile := filepath.Join(dir, "shorturls.dat")
+	offsetFile := filepath.Join(dir, "offset.dat")
+
+	gen := generator.NewGeneratorWithLength(count*10, length)
+	urls, _ := gen.Generate(count)
+
+	f, err := os.Create(urlFile)
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	for _, url := range urls {
+		f.WriteString(url)
+	}
+	f.Close()
+
+	if err := os.WriteFile(offsetFile, []byte("0"), 0644); err != nil {
+		t.Fatalf("create offset: %v", err)
+	}
+	return urlFile, offsetFile
+}
+
+// TestAcquireContext 测试链表为空时等待补充加载
+func TestAcquireContext(t *testing.T) {
+	t.Run("等待补充加载", func(t *testing.T) {
+		urlFile, offsetFile := writePool(t, 100)
+		linkedURL := preload.NewLinkedURL(preload.NewFileLoader(urlFile, offsetFile), 10, 50)
+
+		// 未初始化时非阻塞获取立即失败
+		if _, err := linkedURL.Acquire(); !errors.Is(err, preload.ErrNoURLs) {
+			t.Fatalf("Acquire on empty list: got %v, want ErrNoURLs", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		code, err := linkedURL.AcquireContext(ctx)
+		if err != nil {
+			t.Fatalf("AcquireContext: %v", err)
+		}
+		if len(code) != 6 {
+			t.Fatalf("unexpected code %q", code)
+		}
+	})
+
+	t.Run("号池耗尽", func(t *testing.T) {
+		urlFile, offsetFile := writePool(t, 5)
+		linkedURL := preload.NewLinkedURL(preload.NewFileLoader(urlFile, offsetFile), 1, 50)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		for i := 0; i < 5; i++ {
+			if _, err := linkedURL.AcquireContext(ctx); err != nil {
+				t.Fatalf("acquire %d: %v", i, err)
+			}
+		}
+
+		_, err := linkedURL.AcquireContext(ctx)
+		if !errors.Is(err, preload.ErrPoolExhausted) {
+			t.Fatalf("got %v, want ErrPoolExhausted", err)
+		}
+		if !errors.Is(linkedURL.LastError(), preload.ErrPoolExhausted) {
+			t.Fatalf("LastError: got %v", linkedURL.LastError())
+		}
+	})
+
+	t.Run("等待者多于批量", func(t *testing.T) {
+		urlFile, offsetFile := writePool(t, 1000)
+		linkedURL := preload.NewLinkedURL(preload.NewFileLoader(urlFile, offsetFile), 1, 5)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// 持有偏移量文件锁，使所有等待者都在第一次加载完成前开始等待
+		locked, release := make(chan struct{}), make(chan struct{})
+		go preload.UpdateOffset(offsetFile, func(offset int64) (int64, error) {
+			close(locked)
+			<-release
+			return offset, nil
+		})
+		<-locked
+		time.AfterFunc(100*time.Millisecond, func() { close(release) })
+
+		// 每次加载只够5个等待者，其余等待者应继续等待后续加载，而不是返回ErrNoURLs
+		const waiters = 200
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		codes := make(map[string]bool)
+		for i := 0; i < waiters; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				code, err := linkedURL.AcquireContext(ctx)
+				if err != nil {
+					t.Errorf("AcquireContext: %v", err)
+					return
+				}
+				mu.Lock()
+				codes[code] = true
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		if len(codes) != waiters {
+			t.Fatalf("got %d distinct codes, want %d", len(codes), waiters)
+		}
+
+		// 等待最后一次后台加载结束，避免临时目录被删除时仍在读取
+		for linkedURL.Stats().Loading {
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+// TestTunerAdjust 测试自适应调整跟随获取速率
+func TestTunerAdjust(t *testing.T) {
+	urlFile, offsetFile := writePool(t, 5000)
+	linkedURL := preload.NewLinkedURL(preload.NewFileLoader(urlFile, offsetFile), 10, 4000)
+	if err := linkedURL.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	cfg := preload.DefaultAdaptiveConfig()
+	cfg.MinThreshold = 10
+	cfg.MinBatch = 100
+	tuner := preload.NewTuner(linkedURL, cfg)
+
+	// 模拟突发流量：1秒内获取2000个
+	for i := 0; i < 2000; i++ {
+		linkedURL.Acquire()
+	}
+	now := time.Now().Add(time.Second)
+	tuner.Adjust(now)
+
+	busy := linkedURL.Stats()
+	if busy.AcquireRate < 1000 {
+		t.Fatalf("acquire rate too low: %.1f", busy.AcquireRate)
+	}
+	if busy.BatchSize <= cfg.MinBatch || busy.Threshold <= cfg.MinThreshold {
+		t.Fatalf("not scaled up under load: %+v", busy)
+	}
+
+	// 空闲一段时间后批量回落
+	for i := 0; i < 60; i++ {
+		now = now.Add(time.Second)
+		tuner.Adjust(now)
+	}
+
+	idle := linkedURL.Stats()
+	if idle.BatchSize >= busy.BatchSize || idle.Threshold >= busy.Threshold {
+		t.Fatalf("not scaled down when idle: busy=%+v idle=%+v", busy, idle)
+	}
+	t.Logf("繁忙: 阈值 %d, 批量 %d; 空闲: 阈值 %d, 批量 %d",
+		busy.Threshold, busy.BatchSize, idle.Threshold, idle.BatchSize)
+
+	// 按速率算出的阈值接近批量上限时，批量仍不超过MaxBatch
+	capped := preload.NewLinkedURL(preload.NewFileLoader(writePool(t, 5000)), 10, 4000)
+	if err := capped.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	cfg.MaxBatch = 150
+	cfg.MinBatch = 10
+	cfg.Headroom = 10
+	tuner = preload.NewTuner(capped, cfg)
+	for i := 0; i < 2000; i++ {
+		capped.Acquire()
+	}
+	tuner.Adjust(time.Now().Add(time.Second))
+	if stats := capped.Stats(); stats.BatchSize > cfg.MaxBatch || stats.BatchSize < stats.Threshold*2 {
+		t.Fatalf("threshold %d, batch %d, want batch within MaxBatch %d and at least twice the threshold",
+			stats.Threshold, stats.BatchSize, cfg.MaxBatch)
+	}
+}
+
+// TestMmapFileLoader 测试内存映射加载与普通加载结果一致，且多个加载器共享偏移量
+func TestMmapFileLoader(t *testing.T) {
+	urlFile, offsetFile := writePool(t, 1000)
+
+	data, err := os.ReadFile(urlFile)
+	if err != nil {
+		t.Fatalf("read pool: %v", err)
+	}
+
+	mmapLoader := preload.NewMmapFileLoader(urlFile, offsetFile)
+	defer mmapLoader.Close()
+	fileLoader := preload.NewFileLoader(urlFile, offsetFile)
+
+	var got []string
+	for len(got) < 1000 {
+		loader := mmapLoader
+		if len(got)%300 != 0 {
+			loader = fileLoader
+		}
+		batch, err := loader.LoadBatch(150)
+		if err != nil {
+			t.Fatalf("LoadBatch after %d: %v", len(got), err)
+		}
+		got = append(got, batch...)
+	}
+
+	for i, code := range got {
+		if want := string(data[i*6 : i*6+6]); code != want {
+			t.Fatalf("code %d: got %q, want %q", i, code, want)
+		}
+	}
+
+	if _, err := mmapLoader.LoadBatch(10); !errors.Is(err, preload.ErrPoolExhausted) {
+		t.Fatalf("got %v, want ErrPoolExhausted", err)
+	}
+
+	// 文件被同样大小的新文件替换（如合并后重命名）时重新映射，不读旧文件的内容
+	replacement, _ := writePool(t, 1000)
+	data, err = os.ReadFile(replacement)
+	if err != nil {
+		t.Fatalf("read replacement: %v", err)
+	}
+	if err := os.Rename(replacement, urlFile); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := os.WriteFile(offsetFile, []byte("0"), 0644); err != nil {
+		t.Fatalf("reset offset: %v", err)
+	}
+	batch, err := mmapLoader.LoadBatch(10)
+	if err != nil {
+		t.Fatalf("LoadBatch after replace: %v", err)
+	}
+	if got, want := strings.Join(batch, ""), string(data[:60]); got != want {
+		t.Fatalf("after replace got %q, want %q", got, want)
+	}
+}
+
+// TestPoolManager 测试多号池按名称和API Key路由
+func TestPoolManager(t *testing.T) {
+	premiumURLs, premiumOffset := writePoolWithLength(t, 100, 5)
+	bulkURLs, bulkOffset := writePoolWithLength(t, 100, 7)
+
+	manager, err := preload.NewManager(&preload.Config{
+		Default: "bulk",
+		Pools: []preload.PoolConfig{
+			{Name: "premium", URLFile: premiumURLs, OffsetFile: premiumOffset, CodeLength: 5, Threshold: 10, BatchSize: 50},
+			{Name: "bulk", URLFile: bulkURLs, OffsetFile: bulkOffset, CodeLength: 7, Threshold: 10, BatchSize: 50, Mmap: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	defer manager.Close()
+
+	if err := manager.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	cases := []struct {
+		name, pool string
+		wantPool   string
+		wantLength int
+	}{
+		{"默认号池", "", "bulk", 7},
+		{"按名称", "premium", "premium", 5},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pool, err := manager.Route(tc.pool)
+			if err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if pool.Name != tc.wantPool {
+				t.Fatalf("got pool %q, want %q", pool.Name, tc.wantPool)
+			}
+
+			code, err := pool.List.Acquire()
+			if err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if len(code) != tc.wantLength {
+				t.Fatalf("got code %q, want length %d", code, tc.wantLength)
+			}
+		})
+	}
+
+	if _, err := manager.Route("missing"); !errors.Is(err, preload.ErrUnknownPool) {
+		t.Fatalf("got %v, want ErrUnknownPool", err)
+	}
+
+	// 按未认证的请求头路由的旧配置拒绝启动
+	_, err = preload.NewManager(&preload.Config{
+		Pools:   []preload.PoolConfig{{Name: "premium", URLFile: premiumURLs, OffsetFile: premiumOffset}},
+		APIKeys: map[string]string{"campaign-key": "premium"},
+	})
+	if err == nil {
+		t.Fatal("NewManager accepted api_keys")
+	}
+}
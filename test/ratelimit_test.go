@@ -0,0 +1,245 @@
+package test
+
+import (
+	"fuxi/internal/auth"
+	"fuxi/internal/ratelimit"
+	"fuxi/internal/storage"
+	"fuxi/internal/urlcheck"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestTokenBucket 测试令牌桶的突发、补充和空闲清理
+func TestTokenBucket(t *testing.T) {
+	l := ratelimit.NewLimiter("test-bucket", 1, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		d := l.AllowAt("a", now)
+		if !d.Allowed || d.Remaining != 2-i || d.Limit != 3 {
+			t.Fatalf("request %d: %+v", i, d)
+		}
+	}
+	d := l.AllowAt("a", now)
+	if d.Allowed || d.RetryAfter != time.Second || d.Reset != 3*time.Second {
+		t.Errorf("over limit: %+v, want rejected with RetryAfter 1s, Reset 3s", d)
+	}
+
+	// 其他key不受影响
+	if d := l.AllowAt("b", now); !d.Allowed {
+		t.Errorf("key b rejected: %+v", d)
+	}
+
+	// 1.5秒后补充1.5个令牌
+	now = now.Add(1500 * time.Millisecond)
+	if d := l.AllowAt("a", now); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("after refill: %+v", d)
+	}
+	if d := l.AllowAt("a", now); d.Allowed || d.RetryAfter != 500*time.Millisecond {
+		t.Errorf("after refill, second request: %+v, want RetryAfter 500ms", d)
+	}
+
+	// 空闲到补满的桶在清理时删除，再次请求时与新桶相同
+	now = now.Add(2 * time.Minute)
+	l.AllowAt("c", now)
+	for _, key := range []string{"a", "b"} {
+		l.AllowAt(key, now)
+	}
+	if d := l.AllowAt("a", now); !d.Allowed || d.Remaining != 1 {
+		t.Errorf("after idle: %+v, want full bucket", d)
+	}
+}
+
+// TestRateLimitMiddleware 测试限流中间件的RateLimit-*和Retry-After响应头，以及按API Key区分
+func TestRateLimitMiddleware(t *testing.T) {
+	store, err := storage.NewLayeredStorage(filepath.Join(t.TempDir(), "ratelimit.db"), 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+	_, rawA, _ := store.CreateAPIKey("a", false, 0, "")
+	_, rawB, _ := store.CreateAPIKey("b", false, 0, "")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limiter := ratelimit.NewLimiter("test-middleware", 0.5, 2)
+	authn := auth.NewAuthenticator(store, true, "")
+	r.GET("/redirect", ratelimit.Middleware(limiter, ratelimit.KeyOrIP), func(c *gin.Context) {
+		c.Status(http.StatusFound)
+	})
+	r.POST("/create", authn.Middleware(), ratelimit.Middleware(limiter, ratelimit.KeyOrIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(method, path, remoteAddr, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 按IP限流
+	for i := 0; i < 2; i++ {
+		w := do(http.MethodGet, "/redirect", "10.0.0.1:1234", "")
+		if w.Code != http.StatusFound || w.Header().Get("RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Fatalf("request %d: status %d, headers %v", i, w.Code, w.Header())
+		}
+	}
+	w := do(http.MethodGet, "/redirect", "10.0.0.1:5678", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":         "2",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "4",
+		"RateLimit-Policy":    "2;w=4",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if w := do(http.MethodGet, "/redirect", "10.0.0.2:1234", ""); w.Code != http.StatusFound {
+		t.Errorf("other IP: status = %d, want 302", w.Code)
+	}
+
+	// 同一IP的不同API Key各自计数
+	for i := 0; i < 2; i++ {
+		do(http.MethodPost, "/create", "10.0.0.3:1234", rawA)
+	}
+	if w := do(http.MethodPost, "/create", "10.0.0.3:1234", rawA); w.Code != http.StatusTooManyRequests {
+		t.Errorf("key a: status = %d, want 429", w.Code)
+	}
+	if w := do(http.MethodPost, "/create", "10.0.0.3:1234", rawB); w.Code != http.StatusOK {
+		t.Errorf("key b: status = %d, want 200", w.Code)
+	}
+}
+
+// TestDailyQuota 测试每日配额的持久化计数和中间件
+func TestDailyQuota(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "quota.db")
+	store, err := storage.NewLayeredStorage(dbPath, 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+
+	day := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	for i, want := range []struct {
+		used int
+		ok   bool
+	}{{1, true}, {2, true}, {2, false}} {
+		used, ok, err := store.ConsumeQuota("key:1", day, 2)
+		if err != nil || used != want.used || ok != want.ok {
+			t.Fatalf("consume %d = (%d, %v, %v), want (%d, %v)", i, used, ok, err, want.used, want.ok)
+		}
+	}
+
+	// 重启后计数保留，次日重置
+	store.Close()
+	store, err = storage.NewLayeredStorage(dbPath, 100)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	if _, ok, _ := store.ConsumeQuota("key:1", day, 2); ok {
+		t.Error("quota reset after restart")
+	}
+	if used, ok, _ := store.ConsumeQuota("key:1", day.Add(2*time.Hour), 2); !ok || used != 1 {
+		t.Errorf("next day = (%d, %v), want (1, true)", used, ok)
+	}
+	if n, err := store.PruneQuotas(day.Add(2 * time.Hour)); err != nil || n != 1 {
+		t.Errorf("PruneQuotas = %d, %v, want 1", n, err)
+	}
+
+	// 中间件：超出配额返回429，Retry-After为距UTC零点的秒数
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limits := map[string]int{"ip:10.0.0.1": 1, "ip:10.0.0.2": 0}
+	r.POST("/create", ratelimit.QuotaMiddleware(store, func(c *gin.Context) (string, int) {
+		subject := ratelimit.KeyOrIP(c)
+		return subject, limits[subject]
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/create", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("10.0.0.1:1"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+	w := do("10.0.0.1:1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over quota: status = %d, want 429", w.Code)
+	}
+	retry, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	if retry < 1 || retry > 86400 || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("headers = %v", w.Header())
+	}
+
+	// 上限为0时不计数
+	for i := 0; i < 3; i++ {
+		if w := do("10.0.0.2:1"); w.Code != http.StatusOK {
+			t.Fatalf("unlimited: status = %d", w.Code)
+		}
+	}
+	if used, _ := store.QuotaUsage("ip:10.0.0.2", time.Now()); used != 0 {
+		t.Errorf("unlimited subject counted %d times", used)
+	}
+
+	// 创建失败（如long_url无效）时退还预占的配额
+	validator, _ := urlcheck.NewValidator(urlcheck.DefaultSchemes, nil)
+	r.POST("/shorten", ratelimit.QuotaMiddleware(store, func(c *gin.Context) (string, int) {
+		return ratelimit.KeyOrIP(c), 3
+	}), func(c *gin.Context) {
+		if _, err := validator.Normalize(c.Query("long_url")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	shorten := func(longURL string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten?long_url="+url.QueryEscape(longURL), nil)
+		req.RemoteAddr = "10.0.0.3:1"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for i, tt := range []struct {
+		longURL   string
+		status    int
+		remaining string
+	}{
+		{"https://example.com/1", http.StatusOK, "2"},
+		{"javascript:alert(1)", http.StatusBadRequest, "1"},
+		{"not a url", http.StatusBadRequest, "1"},
+		{"https://example.com/2", http.StatusOK, "1"},
+		{"https://example.com/3", http.StatusOK, "0"},
+		{"https://example.com/4", http.StatusTooManyRequests, "0"},
+	} {
+		w := shorten(tt.longURL)
+		if w.Code != tt.status || w.Header().Get("RateLimit-Remaining") != tt.remaining {
+			t.Errorf("request %d: status = %d, RateLimit-Remaining = %q, want %d, %q",
+				i, w.Code, w.Header().Get("RateLimit-Remaining"), tt.status, tt.remaining)
+		}
+	}
+	if used, _ := store.QuotaUsage("ip:10.0.0.3", time.Now()); used != 3 {
+		t.Errorf("used = %d after 3 successful creations, want 3", used)
+	}
+}
@@ -0,0 +1,220 @@
+package test
+
+import (
+	"context"
+	"fuxi/internal/redirect"
+	"fuxi/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestDestination 测试查询参数合并、路径追加和UTM默认值
+func TestDestination(t *testing.T) {
+	utm := &storage.UTMParams{Source: "newsletter", Medium: "email", Campaign: "spring"}
+	tests := []struct {
+		name   string
+		target storage.Target
+		rest   string
+		query  string
+		want   string
+	}{
+		{"unchanged", storage.Target{URL: "https://example.com/a?b=2&a=1"}, "/x", "c=3", "https://example.com/a?b=2&a=1"},
+		{"query merged", storage.Target{URL: "https://example.com/a?a=1&b=2", ForwardQuery: true}, "", "b=3&c=4", "https://example.com/a?a=1&b=3&c=4"},
+		{"empty query", storage.Target{URL: "https://example.com/a?b=2&a=1", ForwardQuery: true}, "", "", "https://example.com/a?b=2&a=1"},
+		{"path appended", storage.Target{URL: "https://example.com/docs/", ForwardPath: true}, "/guide/intro", "", "https://example.com/docs/guide/intro"},
+		{"path escaped", storage.Target{URL: "https://example.com/docs", ForwardPath: true}, "/../../a b/./c%2Fd", "", "https://example.com/docs/a%20b/c%252Fd"},
+		{"path ignored", storage.Target{URL: "https://example.com/docs"}, "/guide", "", "https://example.com/docs"},
+		{"utm added", storage.Target{URL: "https://example.com/", UTM: utm}, "", "", "https://example.com/?utm_campaign=spring&utm_medium=email&utm_source=newsletter"},
+		{"utm kept from destination", storage.Target{URL: "https://example.com/?utm_source=site", UTM: utm}, "", "", "https://example.com/?utm_campaign=spring&utm_medium=email&utm_source=site"},
+		{"utm overridden by visitor", storage.Target{URL: "https://example.com/", ForwardQuery: true, UTM: utm}, "", "utm_source=ad", "https://example.com/?utm_campaign=spring&utm_medium=email&utm_source=ad"},
+		{"all", storage.Target{URL: "https://example.com/p?x=1#top", ForwardQuery: true, ForwardPath: true, UTM: &storage.UTMParams{Source: "s"}}, "q", "y=2", "https://example.com/p/q?utm_source=s&x=1&y=2#top"},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := redirect.Destination(&tt.target, tt.rest, query)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Destination = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// TestRules 测试条件跳转规则的按顺序匹配和校验
+func TestRules(t *testing.T) {
+	start := time.Date(2026, 11, 11, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	rules := []storage.Rule{
+		{URL: "https://example.com/sale", Start: &start, End: &end},
+		{URL: "https://apps.apple.com/app/id1", Device: "ios"},
+		{URL: "https://play.google.com/store/apps/details?id=x", Device: "android"},
+		{URL: "https://example.com/qr", Query: map[string]string{"src": "qr"}},
+		{URL: "https://example.com/beta", Query: map[string]string{"beta": ""}},
+		{URL: "https://example.com/zh", Languages: []string{"zh"}},
+		{URL: "https://example.com/bot", UserAgent: "Googlebot"},
+		{URL: "https://example.com/m", Device: "mobile"},
+	}
+
+	const (
+		iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+		android = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+		desktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+		phone   = "Mozilla/5.0 (Mobile; rv:48.0) Gecko/48.0 Firefox/48.0 KAIOS/2.5"
+	)
+	now := start.Add(-time.Hour)
+	tests := []struct {
+		name, ua, lang, query string
+		now                   time.Time
+		want                  string
+	}{
+		{"fallback", desktop, "en-US,en;q=0.9", "", now, ""},
+		{"ios", iphone, "", "", now, "https://apps.apple.com/app/id1"},
+		{"android", android, "", "", now, "https://play.google.com/store/apps/details?id=x"},
+		{"time window first", iphone, "", "", start, "https://example.com/sale"},
+		{"window end exclusive", iphone, "", "", end, "https://apps.apple.com/app/id1"},
+		{"query value", desktop, "", "src=qr", now, "https://example.com/qr"},
+		{"query value mismatch", desktop, "", "src=web", now, ""},
+		{"query present", desktop, "", "beta", now, "https://example.com/beta"},
+		{"language prefix", desktop, "zh-CN,zh;q=0.9,en;q=0.8", "", now, "https://example.com/zh"},
+		{"language not preferred", desktop, "en-US,zh-CN;q=0.5", "", now, ""},
+		{"language by weight", desktop, "en;q=0.4,zh-TW;q=0.8", "", now, "https://example.com/zh"},
+		{"user agent", "Mozilla/5.0 (compatible; googlebot/2.1)", "", "", now, "https://example.com/bot"},
+		{"other mobile", phone, "", "", now, "https://example.com/m"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/abc123?"+tt.query, nil)
+		r.Header.Set("User-Agent", tt.ua)
+		if tt.lang != "" {
+			r.Header.Set("Accept-Language", tt.lang)
+		}
+		got, ok := redirect.Select(rules, r, tt.now)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("%s: Select = %q, %v, want %q", tt.name, got, ok, tt.want)
+		}
+	}
+
+	if err := redirect.ValidateRules(rules); err != nil {
+		t.Errorf("ValidateRules: %v", err)
+	}
+	for _, rule := range []storage.Rule{
+		{Device: "ios"},
+		{URL: "https://example.com/"},
+		{URL: "https://example.com/", Device: "windows"},
+		{URL: "https://example.com/", Start: &end, End: &start},
+		{URL: "https://example.com/", Languages: []string{""}},
+		{URL: "https://example.com/", Query: map[string]string{"": "x"}},
+	} {
+		if err := redirect.ValidateRules([]storage.Rule{rule}); err == nil {
+			t.Errorf("ValidateRules(%+v) = nil", rule)
+		}
+	}
+	if err := redirect.ValidateRules(make([]storage.Rule, redirect.MaxRules+1)); err == nil {
+		t.Error("ValidateRules accepted too many rules")
+	}
+}
+
+// TestRedirectHandler 通过gin路由测试重定向：方法限制、Cache-Control、警告页、预览页和路径转发
+func TestRedirectHandler(t *testing.T) {
+	store, err := storage.NewLayeredStorage(filepath.Join(t.TempDir(), "redirect.db"), 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+
+	for _, m := range []*storage.URLMapping{
+		{ShortCode: "perm01", LongURL: "https://example.com/perm", RedirectType: http.StatusMovedPermanently},
+		{ShortCode: "temp01", LongURL: "https://example.com/temp"},
+		{ShortCode: "keep01", LongURL: "https://example.com/keep", RedirectType: http.StatusTemporaryRedirect},
+		{ShortCode: "keep02", LongURL: "https://example.com/keep", RedirectType: http.StatusPermanentRedirect},
+		{ShortCode: "rule01", LongURL: "https://example.com/web", RedirectType: http.StatusMovedPermanently,
+			Rules: []storage.Rule{{URL: "https://apps.apple.com/app/id1", Device: "ios"}}},
+		{ShortCode: "warn01", LongURL: "https://phish.example/login"},
+		{ShortCode: "gate01", LongURL: "https://example.com/gate", Interstitial: true},
+		{ShortCode: "path01", LongURL: "https://example.com/docs", ForwardPath: true},
+	} {
+		if err := store.SaveMapping(context.Background(), m); err != nil {
+			t.Fatalf("SaveMapping(%s): %v", m.ShortCode, err)
+		}
+	}
+	if err := store.DisableMapping("warn01", "phishing"); err != nil {
+		t.Fatalf("DisableMapping: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := redirect.NewHandler(store, time.Hour)
+	handler.Register(r)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	tests := []struct {
+		name, method, path string
+		status             int
+		location           string
+		cacheControl       string
+	}{
+		{"permanent", http.MethodGet, "/perm01", 301, "https://example.com/perm", "public, max-age=3600"},
+		{"temporary", http.MethodGet, "/temp01", 302, "https://example.com/temp", "private, no-store"},
+		{"permanent with rules", http.MethodGet, "/rule01", 301, "https://example.com/web", "private, no-store"},
+		{"307 keeps method", http.MethodPost, "/keep01", 307, "https://example.com/keep", "private, no-store"},
+		{"308 keeps method", http.MethodDelete, "/keep02", 308, "https://example.com/keep", "public, max-age=3600"},
+		{"forward path", http.MethodGet, "/path01/guide/intro", 302, "https://example.com/docs/guide/intro", "private, no-store"},
+		{"path without forward_path", http.MethodGet, "/temp01/rest", 404, "", ""},
+		{"missing", http.MethodGet, "/none01", 404, "", ""},
+	}
+	for _, tt := range tests {
+		w := do(tt.method, tt.path)
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location || w.Header().Get("Cache-Control") != tt.cacheControl {
+			t.Errorf("%s: %s %s = %d, Location %q, Cache-Control %q, want %d, %q, %q", tt.name, tt.method, tt.path,
+				w.Code, w.Header().Get("Location"), w.Header().Get("Cache-Control"), tt.status, tt.location, tt.cacheControl)
+		}
+	}
+
+	// 301和302只接受GET
+	for _, path := range []string{"/perm01", "/temp01"} {
+		w := do(http.MethodPost, path)
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodGet {
+			t.Errorf("POST %s = %d, Allow %q, want 405, GET", path, w.Code, w.Header().Get("Allow"))
+		}
+	}
+
+	// 停用的短URL返回警告页，不包含目标地址
+	w := do(http.MethodGet, "/warn01")
+	body := w.Body.String()
+	if w.Code != http.StatusForbidden || !strings.Contains(body, "This link has been disabled") ||
+		!strings.Contains(body, "phishing") || strings.Contains(body, "phish.example") ||
+		w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Location") != "" {
+		t.Errorf("disabled link = %d, Cache-Control %q, body %s", w.Code, w.Header().Get("Cache-Control"), body)
+	}
+
+	// "+"后缀和?preview=1显示预览页，preview参数不转发；跳转前确认页计入访问量
+	for _, path := range []string{"/temp01+", "/temp01?preview=1", "/gate01"} {
+		w := do(http.MethodGet, path)
+		body := w.Body.String()
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" || w.Header().Get("Cache-Control") != "no-store" ||
+			!strings.Contains(body, "https://example.com/") || strings.Contains(body, "preview=1") {
+			t.Errorf("GET %s = %d, Location %q, body %s", path, w.Code, w.Header().Get("Location"), body)
+		}
+		if strings.Contains(body, "You are leaving") != (path == "/gate01") {
+			t.Errorf("GET %s: wrong preview heading: %s", path, body)
+		}
+	}
+
+	// 预览和警告页不计入访问量
+	handler.Wait()
+	for code, want := range map[string]int64{"temp01": 1, "warn01": 0, "gate01": 1, "perm01": 1} {
+		m, err := store.GetMapping(code)
+		if err != nil || m.AccessCount != want {
+			t.Errorf("%s: access count = %v, %v, want %d", code, m, err, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fuxi/internal/screening"
+	"fuxi/internal/storage"
+	"fuxi/internal/storage/redistest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBlocklist 测试hosts文件和普通列表格式的解析与匹配
+func TestBlocklist(t *testing.T) {
+	dir := t.TempDir()
+	hosts := filepath.Join(dir, "hosts")
+	plain := filepath.Join(dir, "urls.txt")
+
+	os.WriteFile(hosts, []byte(`# StevenBlack-style hosts file
+127.0.0.1 localhost
+::1 ip6-localhost ip6-loopback
+0.0.0.0 phish.example tracker.example  # two names on one line
+0.0.0.0 bad_host.example
+not-an-ip evil.example
+`), 0644)
+	os.WriteFile(plain, []byte(`# one entry per line
+*.malware.example
+Bücher.example
+203.0.113.7
+https://shared.example/user/phisher
+http://files.example:8080/payload.exe
+https://landing.example
+`), 0644)
+
+	list, err := screening.LoadBlocklist(hosts)
+	if err != nil {
+		t.Fatalf("LoadBlocklist: %v", err)
+	}
+	if list.Len() != 2 || list.Invalid() != 2 {
+		t.Errorf("hosts: Len = %d, Invalid = %d, want 2 and 2", list.Len(), list.Invalid())
+	}
+
+	s, err := screening.NewScreener([]string{hosts, plain}, 0)
+	if err != nil {
+		t.Fatalf("NewScreener: %v", err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		url   string
+		entry string
+	}{
+		{"https://phish.example/login", "phish.example"},
+		{"https://WWW.Phish.Example./login", "phish.example"},
+		{"http://a.b.tracker.example", "tracker.example"},
+		{"https://cdn.malware.example/x.js", "malware.example"},
+		{"https://xn--bcher-kva.example/", "xn--bcher-kva.example"},
+		{"http://203.0.113.7:8080/", "203.0.113.7"},
+		{"http://shared.example/user/phisher", "shared.example/user/phisher"},
+		{"https://shared.example/user/phisher/page?x=1", "shared.example/user/phisher"},
+		{"https://shared.example/user/phisher?ref=mail", "shared.example/user/phisher"},
+		{"http://files.example:8080/payload.exe", "files.example:8080/payload.exe"},
+		{"https://notphish.example/", ""},
+		{"https://phish.example.com/", ""},
+		{"https://shared.example/user/phishers", ""},
+		{"https://shared.example/user/other", ""},
+		{"http://files.example/payload.exe", ""},
+		{"https://other.example/user/phisher", ""},
+		{"https://landing.example/any/page?x=1", "landing.example"},
+		{"https://sub.landing.example/", ""},
+		{"https://localhost/", ""},
+		{"https://evil.example/", ""},
+	}
+	for _, tt := range tests {
+		match, blocked := s.Check(tt.url)
+		if blocked != (tt.entry != "") || match.Entry != tt.entry {
+			t.Errorf("Check(%q) = %+v, %v, want entry %q", tt.url, match, blocked, tt.entry)
+		}
+	}
+
+	// 热加载：文件修改后重新加载，未修改时不重新解析
+	if changed, err := s.Reload(); changed || err != nil {
+		t.Errorf("Reload without changes = %v, %v", changed, err)
+	}
+	version := s.Version()
+	os.WriteFile(plain, []byte("new-threat.example\n"), 0644)
+	if changed, err := s.Reload(); !changed || err != nil {
+		t.Fatalf("Reload = %v, %v", changed, err)
+	}
+	if s.Version() == version {
+		t.Error("version not bumped after reload")
+	}
+	if _, blocked := s.Check("https://new-threat.example/"); !blocked {
+		t.Error("new entry not applied")
+	}
+	if _, blocked := s.Check("https://cdn.malware.example/"); blocked {
+		t.Error("removed entry still applied")
+	}
+
+	// 文件被删除时保留上一次的内容
+	os.Remove(hosts)
+	if _, err := s.Reload(); err == nil {
+		t.Error("Reload of missing file returned nil error")
+	}
+	if _, blocked := s.Check("https://phish.example/"); !blocked {
+		t.Error("entries from missing file dropped")
+	}
+}
+
+// TestBlocklistRecheck 测试后台检查停用已有短URL，以及停用状态在缓存和二级缓存中的传递
+func TestBlocklistRecheck(t *testing.T) {
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	dir := t.TempDir()
+	open := func(name string) *storage.LayeredStorage {
+		store, err := storage.NewLayeredStorageWithConfig(storage.Config{
+			DBPath:    filepath.Join(dir, name),
+			CacheSize: 100,
+			Redis:     storage.RedisOptions{Addr: server.Addr(), KeyPrefix: "fuxi:"},
+		})
+		if err != nil {
+			t.Fatalf("NewLayeredStorageWithConfig: %v", err)
+		}
+		return store
+	}
+	store := open("a.db")
+	defer store.Close()
+
+	ctx := context.Background()
+	links := map[string]string{
+		"bad001": "https://phish.example/login",
+		"bad002": "https://www.phish.example/",
+		"ok0001": "https://github.com/golang/go",
+	}
+	for code, longURL := range links {
+		if err := store.Save(code, longURL); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		// 先读一次，确保本地缓存中有旧值
+		store.Get(code)
+	}
+
+	// 长URL正常但规则目标命中名单的短URL也会被停用
+	err = store.SaveMapping(ctx, &storage.URLMapping{ShortCode: "rule01", LongURL: "https://github.com/", Rules: []storage.Rule{
+		{URL: "https://m.phish.example/", Device: "mobile"},
+	}})
+	if err != nil {
+		t.Fatalf("SaveMapping: %v", err)
+	}
+
+	list := filepath.Join(dir, "blocklist.txt")
+	os.WriteFile(list, []byte("phish.example\n"), 0644)
+	screener, err := screening.NewScreener([]string{list}, 0)
+	if err != nil {
+		t.Fatalf("NewScreener: %v", err)
+	}
+	defer screener.Close()
+
+	checked, disabled, err := screening.NewRechecker(screener, store, 0).Scan(ctx)
+	if err != nil || checked != 4 || disabled != 3 {
+		t.Fatalf("Scan = %d, %d, %v, want 4 checked, 3 disabled", checked, disabled, err)
+	}
+	if target, err := store.GetTarget(ctx, "rule01"); err != nil || !target.Disabled() {
+		t.Errorf("GetTarget of link with blocklisted rule = %+v, %v", target, err)
+	}
+
+	if _, err := store.GetContext(ctx, "bad001"); !errors.Is(err, storage.ErrDisabled) {
+		t.Errorf("GetContext of disabled link = %v, want ErrDisabled", err)
+	}
+	target, err := store.GetTarget(ctx, "bad001")
+	if err != nil || !target.Disabled() || !strings.Contains(target.DisabledReason, "phish.example") || target.URL != links["bad001"] {
+		t.Errorf("GetTarget = %+v, %v", target, err)
+	}
+	if longURL, err := store.Get("ok0001"); err != nil || longURL != links["ok0001"] {
+		t.Errorf("Get of clean link = %q, %v", longURL, err)
+	}
+	if m, _ := store.GetMapping("bad002"); m == nil || m.DisabledAt == nil {
+		t.Errorf("GetMapping = %+v, want DisabledAt set", m)
+	}
+
+	// 已停用的短URL不再被检查
+	if checked, disabled, _ := screening.NewRechecker(screener, store, 0).Scan(ctx); checked != 1 || disabled != 0 {
+		t.Errorf("second Scan = %d, %d, want 1 checked, 0 disabled", checked, disabled)
+	}
+
+	// 停用后二级缓存中的旧值被占位值替换，回填不会写回停用前的值；共享数据库的其他实例读到停用状态
+	store.GetTarget(ctx, "bad002")
+	if value, _ := server.Get("fuxi:bad002"); strings.Contains(value, links["bad002"]) && !strings.Contains(value, "disabled_reason") {
+		t.Errorf("L2 value = %q, want stale value evicted", value)
+	}
+	other := open("a.db")
+	defer other.Close()
+	if target, err := other.GetTarget(ctx, "bad002"); err != nil || !target.Disabled() {
+		t.Errorf("GetTarget from other instance = %+v, %v", target, err)
+	}
+
+	// 恢复后重定向到原地址
+	if err := store.EnableMapping("bad001"); err != nil {
+		t.Fatalf("EnableMapping: %v", err)
+	}
+	if longURL, err := store.Get("bad001"); err != nil || longURL != links["bad001"] {
+		t.Errorf("Get after enable = %q, %v", longURL, err)
+	}
+
+	// 管理员恢复的短URL不会被后台检查再次停用，修改目标地址后确认失效
+	if m, _ := store.GetMapping("bad001"); m == nil || m.ReviewedAt == nil {
+		t.Errorf("GetMapping after enable = %+v, want ReviewedAt set", m)
+	}
+	if checked, disabled, _ := screening.NewRechecker(screener, store, 0).Scan(ctx); checked != 1 || disabled != 0 {
+		t.Errorf("Scan after enable = %d, %d, want 1 checked, 0 disabled", checked, disabled)
+	}
+	if err := store.Update("bad001", "https://phish.example/other"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if checked, disabled, _ := screening.NewRechecker(screener, store, 0).Scan(ctx); checked != 2 || disabled != 1 {
+		t.Errorf("Scan after update = %d, %d, want 2 checked, 1 disabled", checked, disabled)
+	}
+	if err := store.DisableMapping("nope00", "test"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DisableMapping unknown = %v, want ErrNotFound", err)
+	}
+}
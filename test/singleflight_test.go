@@ -0,0 +1,78 @@
+package test
+
+import (
+	"errors"
+	"fuxi/internal/singleflight"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSingleflightPanic 测试执行中的查询panic时，等待者不会永远阻塞，之后的调用正常执行
+func TestSingleflightPanic(t *testing.T) {
+	var g singleflight.Group
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	do := func(fn func() (string, error)) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				var p *singleflight.PanicError
+				if e, ok := r.(error); !ok || !errors.As(e, &p) || p.Value != "boom" {
+					t.Errorf("recovered %v, want *PanicError with value boom", r)
+				}
+				err = errors.New("panicked")
+			}
+		}()
+		_, err, _ = g.Do("code01", fn)
+		return err
+	}
+
+	const waiters = 10
+	var wg sync.WaitGroup
+	var panicked atomic.Int32
+	wg.Add(waiters + 1)
+	go func() {
+		defer wg.Done()
+		if do(func() (string, error) {
+			close(started)
+			<-release
+			panic("boom")
+		}) != nil {
+			panicked.Add(1)
+		}
+	}()
+	<-started
+	for i := 0; i < waiters; i++ {
+		go func() {
+			defer wg.Done()
+			if do(func() (string, error) { return "other", nil }) != nil {
+				panicked.Add(1)
+			}
+		}()
+	}
+	// 等待者加入后再让执行者panic
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiters blocked after panic")
+	}
+	if panicked.Load() != waiters+1 {
+		t.Errorf("panicked = %d, want %d", panicked.Load(), waiters+1)
+	}
+
+	// panic后key已释放，新的调用重新执行
+	val, err, shared := g.Do("code01", func() (string, error) { return "https://example.com/", nil })
+	if val != "https://example.com/" || err != nil || shared {
+		t.Errorf("Do after panic = %q, %v, %v", val, err, shared)
+	}
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fuxi/internal/storage"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestTargetAttributes 测试每个短URL的重定向设置随长URL一起写入缓存，并在重启后从数据库恢复
+func TestTargetAttributes(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "target.db")
+	store, err := storage.NewLayeredStorage(dbPath, 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+
+	ctx := context.Background()
+	mappings := []*storage.URLMapping{
+		{ShortCode: "plain1", LongURL: "https://example.com/plain"},
+		{ShortCode: "inter1", LongURL: "https://example.com/inter", Interstitial: true},
+		{ShortCode: "perm01", LongURL: "https://example.com/seo", RedirectType: http.StatusMovedPermanently},
+		{ShortCode: "post01", LongURL: "https://example.com/api", RedirectType: http.StatusTemporaryRedirect},
+		{ShortCode: "perm02", LongURL: "https://example.com/api/v2", RedirectType: http.StatusPermanentRedirect},
+		{ShortCode: "fwd001", LongURL: "https://example.com/docs", ForwardQuery: true, ForwardPath: true,
+			UTM: storage.UTMParams{Source: "newsletter", Campaign: "spring"}},
+		{ShortCode: "rules1", LongURL: "https://example.com/web", Rules: []storage.Rule{
+			{URL: "https://apps.apple.com/app/id1", Device: "ios"},
+			{URL: "https://example.com/zh", Languages: []string{"zh"}, Query: map[string]string{"src": "qr"}},
+		}},
+	}
+	for _, m := range mappings {
+		if err := store.SaveMapping(ctx, m); err != nil {
+			t.Fatalf("SaveMapping: %v", err)
+		}
+	}
+
+	check := func(stage string, s *storage.LayeredStorage) {
+		t.Helper()
+		for _, m := range mappings {
+			target, err := s.GetTarget(ctx, m.ShortCode)
+			if err != nil {
+				t.Fatalf("%s: GetTarget(%s): %v", stage, m.ShortCode, err)
+			}
+			if target.URL != m.LongURL || target.Interstitial != m.Interstitial || target.Status() != m.RedirectType {
+				t.Errorf("%s: GetTarget(%s) = %+v", stage, m.ShortCode, target)
+			}
+		}
+	}
+	// 未指定重定向类型时保存为302
+	if mappings[0].RedirectType != http.StatusFound {
+		t.Fatalf("default RedirectType = %d, want 302", mappings[0].RedirectType)
+	}
+	check("cache", store)
+
+	store.Close()
+	store, err = storage.NewLayeredStorage(dbPath, 100)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	check("database", store)
+	check("cache after load", store)
+
+	if m, err := store.GetMapping("inter1"); err != nil || !m.Interstitial {
+		t.Errorf("GetMapping = %+v, %v", m, err)
+	}
+
+	// 修改规则和兜底地址后缓存失效，清除规则后恢复为只有长URL
+	rules := []storage.Rule{{URL: "https://example.com/android", Device: "android"}}
+	if err := store.UpdateRulesOwned(42, "rules1", "https://example.com/other", rules); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateRulesOwned by other key = %v, want ErrNotFound", err)
+	}
+	if err := store.UpdateRules("rules1", "https://example.com/web2", rules); err != nil {
+		t.Fatalf("UpdateRules: %v", err)
+	}
+	if target, err := store.GetTarget(ctx, "rules1"); err != nil || target.URL != "https://example.com/web2" || !reflect.DeepEqual(target.Rules, rules) {
+		t.Errorf("GetTarget after UpdateRules = %+v, %v", target, err)
+	}
+	if err := store.UpdateRules("rules1", "https://example.com/web2", nil); err != nil {
+		t.Fatalf("UpdateRules(nil): %v", err)
+	}
+	if target, err := store.GetTarget(ctx, "rules1"); err != nil || len(target.Rules) != 0 {
+		t.Errorf("GetTarget after clearing rules = %+v, %v", target, err)
+	}
+	if longURL, err := store.Get("rules1"); err != nil || longURL != "https://example.com/web2" {
+		t.Errorf("Get after clearing rules = %q, %v", longURL, err)
+	}
+
+	for status, want := range map[int][2]bool{
+		http.StatusMovedPermanently:  {true, false},
+		http.StatusFound:             {false, false},
+		http.StatusTemporaryRedirect: {false, true},
+		http.StatusPermanentRedirect: {true, true},
+	} {
+		target := storage.Target{RedirectType: status}
+		if target.Permanent() != want[0] || target.PreservesMethod() != want[1] {
+			t.Errorf("%d: Permanent = %v, PreservesMethod = %v, want %v", status, target.Permanent(), target.PreservesMethod(), want)
+		}
+	}
+	for _, status := range []int{0, 200, 303, 304, 399} {
+		if storage.ValidRedirectType(status) {
+			t.Errorf("ValidRedirectType(%d) = true", status)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"fuxi/internal/preload"
+	"fuxi/internal/storage"
+	"fuxi/internal/tracing"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// findSpan 按名称查找已结束的span
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("span %q not found", name)
+	return tracetest.SpanStub{}
+}
+
+// spanAttr 返回span的属性值
+func spanAttr(s tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// TestTracing 测试存储、预加载和HTTP中间件的span及traceparent传播
+//
+// 全局TracerProvider只能委托一次，因此所有场景放在同一个测试中共用一个导出器。
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.InstallExporter(exporter)
+	defer provider.Shutdown(context.Background())
+
+	store, err := storage.NewLayeredStorage(filepath.Join(t.TempDir(), "tracing.db"), 100)
+	if err != nil {
+		t.Fatalf("NewLayeredStorage: %v", err)
+	}
+	defer store.Close()
+
+	t.Run("storage", func(t *testing.T) {
+		exporter.Reset()
+
+		if err := store.SaveContext(context.Background(), "trc001", "https://example.com/a"); err != nil {
+			t.Fatalf("SaveContext: %v", err)
+		}
+		store.GetContext(context.Background(), "trc001")
+		if _, err := store.GetContext(context.Background(), "nope00"); err != storage.ErrNotFound {
+			t.Fatalf("GetContext missing: %v", err)
+		}
+
+		spans := exporter.GetSpans()
+		save := findSpan(t, spans, "LayeredStorage.Save")
+		insert := findSpan(t, spans, "db.INSERT")
+		if insert.Parent.SpanID() != save.SpanContext.SpanID() {
+			t.Errorf("INSERT span parent = %s, want Save span %s", insert.Parent.SpanID(), save.SpanContext.SpanID())
+		}
+
+		// 未找到不算错误
+		for _, s := range spans {
+			if s.Name == "LayeredStorage.Get" && s.Status.Code.String() == "Error" {
+				t.Errorf("Get span marked as error: %s", s.Status.Description)
+			}
+		}
+	})
+
+	t.Run("preload", func(t *testing.T) {
+		exporter.Reset()
+
+		urlFile, offsetFile := writePool(t, 20)
+		loader := preload.NewFileLoader(urlFile, offsetFile)
+		loader.SetName("trace")
+		codes, err := loader.LoadBatchContext(context.Background(), 5)
+		if err != nil || len(codes) != 5 {
+			t.Fatalf("LoadBatchContext: %d codes, %v", len(codes), err)
+		}
+
+		s := findSpan(t, exporter.GetSpans(), "FileLoader.LoadBatch")
+		if got := spanAttr(s, "batch.loaded").AsInt64(); got != 5 {
+			t.Errorf("batch.loaded = %d, want 5", got)
+		}
+		if got := spanAttr(s, "pool").AsString(); got != "trace" {
+			t.Errorf("pool = %q, want trace", got)
+		}
+		if len(s.Events) != 1 || s.Events[0].Name != "offset.locked" {
+			t.Errorf("events = %v, want offset.locked", s.Events)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		exporter.Reset()
+		store.Save("trc002", "https://example.com/b")
+		exporter.Reset()
+
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(tracing.Middleware("fuxi/test"))
+		r.GET("/:code", func(c *gin.Context) {
+			longURL, err := store.GetContext(c.Request.Context(), c.Param("code"))
+			if err != nil {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			c.Redirect(http.StatusFound, longURL)
+		})
+
+		const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		const parentID = "00f067aa0ba902b7"
+		req := httptest.NewRequest(http.MethodGet, "/trc002", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusFound {
+			t.Fatalf("status = %d, want 302", w.Code)
+		}
+		if tp := w.Header().Get("traceparent"); !strings.HasPrefix(tp, "00-"+traceID+"-") {
+			t.Errorf("response traceparent = %q, want trace %s", tp, traceID)
+		}
+
+		spans := exporter.GetSpans()
+		server := findSpan(t, spans, "GET /:code")
+		if server.SpanContext.TraceID().String() != traceID {
+			t.Errorf("server trace = %s, want %s", server.SpanContext.TraceID(), traceID)
+		}
+		if server.Parent.SpanID().String() != parentID {
+			t.Errorf("server parent = %s, want %s", server.Parent.SpanID(), parentID)
+		}
+		if got := spanAttr(server, "http.response.status_code").AsInt64(); got != 302 {
+			t.Errorf("status attribute = %d, want 302", got)
+		}
+
+		get := findSpan(t, spans, "LayeredStorage.Get")
+		if get.Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("Get span parent = %s, want server span %s", get.Parent.SpanID(), server.SpanContext.SpanID())
+		}
+		if get.SpanContext.TraceID().String() != traceID {
+			t.Errorf("Get span trace = %s, want %s", get.SpanContext.TraceID(), traceID)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"errors"
+	"fuxi/internal/urlcheck"
+	"strings"
+	"testing"
+)
+
+// TestURLValidation 测试目标URL的校验、规范化和重定向循环检测
+func TestURLValidation(t *testing.T) {
+	v, err := urlcheck.NewValidator(nil, []string{"fx.example", "Short.Example:8080"})
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+
+	valid := []struct {
+		raw  string
+		want string
+	}{
+		{"https://github.com/golang/go", "https://github.com/golang/go"},
+		{"  HTTPS://WWW.Example.COM/Path?q=1#Frag  ", "https://www.example.com/Path?q=1#Frag"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"https://example.com:443", "https://example.com"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"https://example.com./a", "https://example.com/a"},
+		{"https://bücher.example/книги", "https://xn--bcher-kva.example/%D0%BA%D0%BD%D0%B8%D0%B3%D0%B8"},
+		{"https://ＥＸＡＭＰＬＥ.com", "https://example.com"},
+		{"http://[2001:DB8::1]:8080/", "http://[2001:db8::1]:8080/"},
+		{"http://192.0.2.1/", "http://192.0.2.1/"},
+	}
+	for _, tt := range valid {
+		got, err := v.Normalize(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		raw  string
+		code urlcheck.Code
+	}{
+		{"   ", urlcheck.CodeEmpty},
+		{"https://example.com/" + strings.Repeat("a", urlcheck.MaxLength), urlcheck.CodeTooLong},
+		{"https://example.com/\x00", urlcheck.CodeMalformed},
+		{"http://exa mple.com", urlcheck.CodeMalformed},
+		{"/relative/path", urlcheck.CodeRelative},
+		{"example.com/page", urlcheck.CodeRelative},
+		{"//example.com/page", urlcheck.CodeRelative},
+		{"javascript:alert(1)", urlcheck.CodeScheme},
+		{"data:text/html;base64,PHNjcmlwdD4=", urlcheck.CodeScheme},
+		{"ftp://example.com/file", urlcheck.CodeScheme},
+		{"http:example.com", urlcheck.CodeMissingHost},
+		{"https:///path", urlcheck.CodeMissingHost},
+		{"https://bank.example@evil.example/", urlcheck.CodeCredentials},
+		{"https://exa_mple.com/", urlcheck.CodeInvalidHost},
+		{"https://-example.com/", urlcheck.CodeInvalidHost},
+		{"https://example.com:99999/", urlcheck.CodeInvalidHost},
+		{"https://fx.example/abc123", urlcheck.CodeLoop},
+		{"http://FX.EXAMPLE.:8080/abc123", urlcheck.CodeLoop},
+		{"https://short.example/abc123", urlcheck.CodeLoop},
+	}
+	for _, tt := range invalid {
+		_, err := v.Normalize(tt.raw)
+		var verr *urlcheck.Error
+		if !errors.As(err, &verr) || verr.Code != tt.code {
+			t.Errorf("Normalize(%q) = %v, want code %s", tt.raw, err, tt.code)
+		}
+	}
+
+	// 请求的Host也视为本服务
+	if _, err := v.Normalize("http://localhost:8080/abc", "localhost:8080"); err == nil {
+		t.Error("link to request host accepted")
+	}
+	if _, err := v.Normalize("http://localhost:9090/abc", "127.0.0.1:8080"); err != nil {
+		t.Errorf("link to other host rejected: %v", err)
+	}
+
+	// 自定义scheme白名单
+	v, _ = urlcheck.NewValidator([]string{"HTTPS"}, nil)
+	if _, err := v.Normalize("http://example.com"); err == nil {
+		t.Error("http accepted with https-only allowlist")
+	}
+	if _, err := v.Normalize("https://example.com"); err != nil {
+		t.Errorf("https rejected: %v", err)
+	}
+	if _, err := urlcheck.NewValidator(nil, []string{"bad_host.example"}); err == nil {
+		t.Error("invalid short domain accepted")
+	}
+}